@@ -0,0 +1,170 @@
+package acb
+
+import "encoding/binary"
+
+type referenceKey struct {
+	Type  uint16
+	Index uint16
+}
+
+// waveformPlacement is role and step given by the nearest container
+type waveformPlacement struct {
+	Role CriAcbWaveformRole
+	Step int
+}
+
+// cueWalker follows Cue -> Sequence -> Track -> TrackEvent -> Synth -> Waveform
+type cueWalker struct {
+	af *CriAcbFile
+	// visited is references of current path, it stops reference cycles
+	visited   map[referenceKey]bool
+	waveforms []CriAcbCueWaveform
+}
+
+func (af *CriAcbFile) resolveCueWaveforms(cue *CriAcbCueRecord) error {
+	w := &cueWalker{
+		af:      af,
+		visited: make(map[referenceKey]bool),
+	}
+	err := w.walk(uint16(cue.ReferenceType), cue.ReferenceIndex, waveformPlacement{Role: WaveformRoleSingle})
+	if err != nil {
+		return err
+	}
+	cue.Waveforms = w.waveforms
+	return nil
+}
+
+// place returns placement of i-th child in container holding count children
+func place(parent waveformPlacement, containerType byte, i, count int) waveformPlacement {
+	if count <= 1 {
+		return parent
+	}
+	return waveformPlacement{Role: containerRole(containerType), Step: i}
+}
+
+func (w *cueWalker) walk(referenceType, index uint16, p waveformPlacement) error {
+	key := referenceKey{Type: referenceType, Index: index}
+	if w.visited[key] {
+		return nil
+	}
+	// only references on current path are skipped, containers may play the same item again
+	w.visited[key] = true
+	defer delete(w.visited, key)
+
+	switch referenceType {
+	case referenceTypeNone:
+		return nil
+	case referenceTypeWaveform:
+		return w.walkWaveform(index, p)
+	case referenceTypeSynth:
+		return w.walkSynth(index, p)
+	case referenceTypeSequence:
+		return w.walkSequence(index, p)
+	case referenceTypeBlockSequence:
+		return w.walkBlockSequence(index, p)
+	default:
+		return ErrUnexpectedReferenceType
+	}
+}
+
+func (w *cueWalker) walkWaveform(index uint16, p waveformPlacement) error {
+	if int(index) >= len(w.af.Waveforms) {
+		return ErrReferenceOutOfRange
+	}
+	waveform := w.af.Waveforms[index]
+	w.waveforms = append(w.waveforms, CriAcbCueWaveform{
+		Index:       index,
+		ID:          waveform.ID,
+		EncodeType:  waveform.EncodeType,
+		IsStreaming: waveform.IsStreaming,
+		Role:        p.Role,
+		Step:        p.Step,
+
+		StreamAwbPortNo:      waveform.StreamAwbPortNo,
+		CriAcbWaveformFormat: waveform.CriAcbWaveformFormat,
+	})
+	return nil
+}
+
+func (w *cueWalker) walkSynth(index uint16, p waveformPlacement) error {
+	if int(index) >= len(w.af.Synths) {
+		return ErrReferenceOutOfRange
+	}
+	synth := w.af.Synths[index]
+	for i, item := range synth.ReferenceItems {
+		err := w.walk(item.Type, item.Index, place(p, synth.Type, i, len(synth.ReferenceItems)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *cueWalker) walkSequence(index uint16, p waveformPlacement) error {
+	if int(index) >= len(w.af.Sequences) {
+		return ErrReferenceOutOfRange
+	}
+	sequence := w.af.Sequences[index]
+	for i, trackIndex := range sequence.TrackIndex {
+		err := w.walkTrack(trackIndex, place(p, sequence.Type, i, len(sequence.TrackIndex)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *cueWalker) walkBlockSequence(index uint16, p waveformPlacement) error {
+	if int(index) >= len(w.af.BlockSequences) {
+		return ErrReferenceOutOfRange
+	}
+	blockSequence := w.af.BlockSequences[index]
+	for _, trackIndex := range blockSequence.TrackIndex {
+		err := w.walkTrack(trackIndex, p)
+		if err != nil {
+			return err
+		}
+	}
+	// blocks are played one after another
+	for i, blockIndex := range blockSequence.BlockIndex {
+		if int(blockIndex) >= len(w.af.Blocks) {
+			return ErrReferenceOutOfRange
+		}
+		blockPlacement := place(p, containerTypeSequential, i, len(blockSequence.BlockIndex))
+		for _, trackIndex := range w.af.Blocks[blockIndex].TrackIndex {
+			err := w.walkTrack(trackIndex, blockPlacement)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *cueWalker) walkTrack(index uint16, p waveformPlacement) error {
+	if int(index) >= len(w.af.Tracks) {
+		return ErrReferenceOutOfRange
+	}
+	eventIndex := w.af.Tracks[index].EventIndex
+	if eventIndex == 0xFFFF {
+		return nil
+	}
+	if int(eventIndex) >= len(w.af.TrackEvents) {
+		return ErrReferenceOutOfRange
+	}
+	for _, command := range w.af.TrackEvents[eventIndex].Commands {
+		switch command.Code {
+		case commandCodeNoteOn, commandCodeNoteOnWithNo:
+			if len(command.Data) < 4 {
+				continue
+			}
+			referenceType := binary.BigEndian.Uint16(command.Data)
+			referenceIndex := binary.BigEndian.Uint16(command.Data[2:])
+			err := w.walk(referenceType, referenceIndex, p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
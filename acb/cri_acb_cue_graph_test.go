@@ -0,0 +1,77 @@
+package acb
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func noteOn(referenceType, index uint16) CriAcbTrackEventRecord {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data, referenceType)
+	binary.BigEndian.PutUint16(data[2:], index)
+	return CriAcbTrackEventRecord{Commands: []CriAcbCommand{{Code: commandCodeNoteOn, Data: data}}}
+}
+
+func TestSequenceRepeatsWaveform(t *testing.T) {
+	format := CriAcbWaveformFormat{SamplingRate: 1000, NumSamples: 1000}
+	af := &CriAcbFile{
+		Sequences:   []CriAcbSequenceRecord{{Type: containerTypeSequential, TrackIndex: []uint16{0, 1, 0}}},
+		Tracks:      []CriAcbTrackRecord{{EventIndex: 0}, {EventIndex: 1}},
+		TrackEvents: []CriAcbTrackEventRecord{noteOn(referenceTypeWaveform, 0), noteOn(referenceTypeSynth, 0)},
+		Synths:      []CriAcbSynthRecord{{ReferenceItems: []CriAcbReferenceItem{{Type: referenceTypeWaveform, Index: 1}}}},
+		Waveforms:   []CriAcbWaveformRecord{{ID: 10, CriAcbWaveformFormat: format}, {ID: 11, CriAcbWaveformFormat: format}},
+	}
+	cue := CriAcbCueRecord{ReferenceType: referenceTypeSequence, ReferenceIndex: 0}
+	err := af.resolveCueWaveforms(&cue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantIDs := []uint16{10, 11, 10}
+	if len(cue.Waveforms) != len(wantIDs) {
+		t.Fatalf("waveforms = %+v", cue.Waveforms)
+	}
+	for i, waveform := range cue.Waveforms {
+		if waveform.ID != wantIDs[i] || waveform.Step != i || waveform.Role != WaveformRoleSequence {
+			t.Errorf("waveform %d = %+v", i, waveform)
+		}
+	}
+	if d := cue.Duration(); d != 3*time.Second {
+		t.Errorf("duration = %v, want 3s", d)
+	}
+}
+
+func TestReferenceCycle(t *testing.T) {
+	af := &CriAcbFile{
+		Synths:    []CriAcbSynthRecord{{ReferenceItems: []CriAcbReferenceItem{{Type: referenceTypeWaveform, Index: 0}, {Type: referenceTypeSynth, Index: 0}}}},
+		Waveforms: []CriAcbWaveformRecord{{ID: 1}},
+	}
+	cue := CriAcbCueRecord{ReferenceType: referenceTypeSynth, ReferenceIndex: 0}
+	err := af.resolveCueWaveforms(&cue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cue.Waveforms) != 1 {
+		t.Errorf("waveforms = %+v", cue.Waveforms)
+	}
+}
+
+func TestTrackNoteOnWithNo(t *testing.T) {
+	event := noteOn(referenceTypeWaveform, 1)
+	event.Commands[0].Code = commandCodeNoteOnWithNo
+	af := &CriAcbFile{
+		Sequences:   []CriAcbSequenceRecord{{Type: containerTypeSequential, TrackIndex: []uint16{0}}},
+		Tracks:      []CriAcbTrackRecord{{EventIndex: 0}},
+		TrackEvents: []CriAcbTrackEventRecord{event},
+		Waveforms:   []CriAcbWaveformRecord{{ID: 10}, {ID: 11}},
+	}
+	cue := CriAcbCueRecord{ReferenceType: referenceTypeSequence, ReferenceIndex: 0}
+	err := af.resolveCueWaveforms(&cue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cue.Waveforms) != 1 || cue.Waveforms[0].ID != 11 {
+		t.Errorf("waveforms = %+v", cue.Waveforms)
+	}
+}
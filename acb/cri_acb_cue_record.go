@@ -1,6 +1,9 @@
 package acb
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 const (
 	waveformEncodeTypeAdx         = 0
@@ -23,12 +26,112 @@ type CriAcbCueRecord struct {
 	EncodeType           byte
 	IsStreaming          bool
 
+	Waveforms []CriAcbCueWaveform
+
+	// Aisacs are aisac controls of the cue synth or sequence
+	Aisacs []CriAcbCueAisac
+
+	// Categories are acf category indexes of the cue synth or sequence, CategoryNames are resolved by AttachAcf
+	Categories    []uint16
+	CategoryNames []string
+
 	CueName string
 }
 
+// CriAcbCueAisac is aisac control of cue
+// global aisac is defined in acf by name, its control is resolved by AttachAcf
+type CriAcbCueAisac struct {
+	Global      bool
+	Name        string
+	ControlID   uint16
+	ControlName string
+}
+
+// CriAcbWaveformRole is how the waveform is played in the cue
+type CriAcbWaveformRole byte
+
+// waveform roles
+const (
+	WaveformRoleSingle CriAcbWaveformRole = iota
+	WaveformRoleLayer
+	WaveformRoleRandom
+	WaveformRoleSequence
+	WaveformRoleSwitch
+)
+
+func (r CriAcbWaveformRole) String() string {
+	switch r {
+	case WaveformRoleSingle:
+		return "single"
+	case WaveformRoleLayer:
+		return "layer"
+	case WaveformRoleRandom:
+		return "random"
+	case WaveformRoleSequence:
+		return "sequence"
+	case WaveformRoleSwitch:
+		return "switch"
+	default:
+		return fmt.Sprintf("role-%d", byte(r))
+	}
+}
+
+// CriAcbCueWaveform is waveform that the cue can play
+type CriAcbCueWaveform struct {
+	Index       uint16
+	ID          uint16
+	EncodeType  byte
+	IsStreaming bool
+
+	// StreamAwbPortNo is port of streaming awb holding the waveform
+	StreamAwbPortNo uint16
+
+	// Role and Step come from the innermost synth/sequence that holds
+	// more than one item; Step is the position in that container
+	Role CriAcbWaveformRole
+	Step int
+
+	CriAcbWaveformFormat
+}
+
+// Duration returns play time of cue, sequence steps are summed and others are the longest
+func (cr CriAcbCueRecord) Duration() time.Duration {
+	var sequence, longest time.Duration
+	for _, waveform := range cr.Waveforms {
+		duration := waveform.Duration()
+		if waveform.Role == WaveformRoleSequence {
+			sequence += duration
+		} else if duration > longest {
+			longest = duration
+		}
+	}
+	if sequence > longest {
+		return sequence
+	}
+	return longest
+}
+
 // GetFileExtension return file extension (.xxx)
 func (cr CriAcbCueRecord) GetFileExtension() string {
-	switch cr.EncodeType {
+	return fileExtension(cr.EncodeType)
+}
+
+// GetFileExtension return file extension (.xxx)
+func (cw CriAcbCueWaveform) GetFileExtension() string {
+	return fileExtension(cw.EncodeType)
+}
+
+// WaveformFileName return file name of i-th waveform (CueName_NN.xxx when cue has multiple waveforms)
+func (cr CriAcbCueRecord) WaveformFileName(i int) string {
+	ext := cr.Waveforms[i].GetFileExtension()
+	if len(cr.Waveforms) == 1 {
+		return cr.CueName + ext
+	}
+	return fmt.Sprintf("%s_%02d%s", cr.CueName, i, ext)
+}
+
+func fileExtension(encodeType byte) string {
+	switch encodeType {
 	case waveformEncodeTypeAdx:
 		return ".adx"
 	case waveformEncodeTypeHca:
@@ -42,6 +145,6 @@ func (cr CriAcbCueRecord) GetFileExtension() string {
 	case waveformEncodeTypeNintendoDsp:
 		return ".dsp"
 	default:
-		return fmt.Sprintf(".EncodeType-%d.bin", cr.EncodeType)
+		return fmt.Sprintf(".EncodeType-%d.bin", encodeType)
 	}
 }
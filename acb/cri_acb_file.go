@@ -1,19 +1,73 @@
 package acb
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
+	"path"
 	"path/filepath"
+
+	"github.com/vazrupe/go-acb/crilayla"
+	"github.com/vazrupe/go-acb/hca"
 )
 
 // CriAcbFile is Acb file structure
 type CriAcbFile struct {
 	base               *CriUtfTable
+	version            uint32
 	Cue                []CriAcbCueRecord
 	CueNameToWaveForms map[string]uint16
 
+	Synths         []CriAcbSynthRecord
+	Sequences      []CriAcbSequenceRecord
+	BlockSequences []CriAcbBlockSequenceRecord
+	Blocks         []CriAcbBlockRecord
+	Tracks         []CriAcbTrackRecord
+	TrackEvents    []CriAcbTrackEventRecord
+	Waveforms      []CriAcbWaveformRecord
+
+	Aisacs                []CriAcbAisacRecord
+	AisacControlNames     map[uint16]string
+	GlobalAisacReferences []string
+
+	// Acf is project config attached by AttachAcf
+	Acf *CriAcfFile
+
 	InternalAwb *CriAfs2Archive
 	ExternalAwb *CriAfs2Archive
+
+	// StreamAwbs are streaming awbs by StreamAwbPortNo, ExternalAwb is port 0
+	StreamAwbs []*CriAfs2Archive
+
+	streamAwbReaders []io.ReaderAt
+	closers          []io.Closer
+}
+
+// StreamAwbResolver returns streaming awb reader of port, name is awb name in acb (empty in old acb)
+// nil reader without error means the awb is searched in FS
+type StreamAwbResolver func(port int, name string) (io.ReaderAt, error)
+
+// OpenOptions is option for Open
+type OpenOptions struct {
+	// StreamAwb is streaming awb reader of port 0. used before FS search
+	StreamAwb io.ReaderAt
+
+	// Resolver locates streaming awb of each port. used before FS search
+	// reader which is io.Closer is closed by Close
+	Resolver StreamAwbResolver
+
+	// VerifyHash compares StreamAwbHash with streaming awb, the whole awb is read
+	// afs2 header is always compared
+	VerifyHash bool
+
+	// FS and Name are used to search streaming awb next to acb
+	// Name is acb file name in FS
+	FS   fs.FS
+	Name string
 }
 
 // LoadCriAcbFile is load file to *CriAcbFile
@@ -23,11 +77,53 @@ func LoadCriAcbFile(path string) (acbFile *CriAcbFile, err error) {
 		return nil, err
 	}
 	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Open(f, stat.Size(), &OpenOptions{
+		FS:   os.DirFS(filepath.Dir(path)),
+		Name: filepath.Base(path),
+	})
+}
+
+// LoadCriAcbFileFS is load file in fsys to *CriAcbFile
+func LoadCriAcbFileFS(fsys fs.FS, name string) (acbFile *CriAcbFile, err error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return Open(bytes.NewReader(data), int64(len(data)), &OpenOptions{
+		FS:   fsys,
+		Name: name,
+	})
+}
+
+// Open is load acb from r to *CriAcbFile
+// streaming awb found by opts is kept open until Close
+func Open(r io.ReaderAt, size int64, opts *OpenOptions) (acbFile *CriAcbFile, err error) {
+	if opts == nil {
+		opts = &OpenOptions{}
+	}
+	r, size, err = decompressTable(r, size)
+	if err != nil {
+		return
+	}
 	acbFile = &CriAcbFile{}
-	acbFile.base, err = NewCriUtfTable(f, 0)
+	acbFile.base, err = NewCriUtfTable(io.NewSectionReader(r, 0, size), 0)
 	if err != nil {
 		return
 	}
+	if acbFile.base.NumberOfRows == 0 {
+		return nil, ErrRowOutOfRange
+	}
+	if acbFile.base.HasColumn("Version") {
+		version, err := acbFile.base.uintValue(0, "Version", math.MaxUint32)
+		if err != nil {
+			return nil, err
+		}
+		acbFile.version = uint32(version)
+	}
 
 	err = acbFile.initializeCueList()
 	if err != nil {
@@ -40,86 +136,114 @@ func LoadCriAcbFile(path string) (acbFile *CriAcbFile, err error) {
 
 	acbFile.InternalAwb = nil
 	acbFile.ExternalAwb = nil
-	internalAwbFile, ok := acbFile.base.Rows[0]["AwbFile"]
-	if ok && internalAwbFile.Size > 0 {
-		acbFile.InternalAwb, err = LoadCriAfs2Archive(acbFile.base.buf, int64(internalAwbFile.Offset))
+	acbFile.StreamAwbs = nil
+	internalAwbFile, err := acbFile.base.optionalData(0, "AwbFile")
+	if err != nil {
+		return
+	}
+	if len(internalAwbFile) > 0 {
+		acbFile.InternalAwb, err = LoadCriAfs2Archive(acbFile.base.buf, int64(acbFile.base.Rows[0]["AwbFile"].Offset))
 		if err != nil {
 			return
 		}
 	}
 
-	streamAwbFileSize, ok := acbFile.base.Rows[0]["StreamAwbAfs2Header"].Value.(uint64)
-	if ok && streamAwbFileSize > 0 {
-		err = acbFile.initializeExternalAwbArchive(path)
+	streamAwbHeader, err := acbFile.base.optionalData(0, "StreamAwbAfs2Header")
+	if err != nil {
+		return
+	}
+	if len(streamAwbHeader) > 0 {
+		err = acbFile.initializeExternalAwbArchive(opts)
 		if err != nil {
-			return
+			acbFile.Close()
+			return nil, err
 		}
 	}
 	return
 }
 
+// decompressTable returns decompressed acb (or acf) when r is crilayla compressed
+func decompressTable(r io.ReaderAt, size int64) (io.ReaderAt, int64, error) {
+	signature := make([]byte, len(crilayla.Signature))
+	n, _ := r.ReadAt(signature, 0)
+	if !crilayla.IsCrilayla(signature[:n]) {
+		return r, size, nil
+	}
+	data, err := crilayla.NewReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, data.Size(), nil
+}
+
+// Close is close streaming awb opened by Open
+func (af *CriAcbFile) Close() error {
+	var err error
+	for _, c := range af.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	af.closers = nil
+	return err
+}
+
 // ErrUnexpectedReferenceType is unexpected referencetype error
 var ErrUnexpectedReferenceType = errors.New("unexpected referencetype")
 
-func (af *CriAcbFile) initializeCueList() (err error) {
-	cueTableField, okCue := af.base.Rows[0]["CueTable"]
-	waveformTableField, okWaveform := af.base.Rows[0]["WaveformTable"]
-	synthTableField, okSynth := af.base.Rows[0]["SynthTable"]
-	if !okCue || !okWaveform || !okSynth {
-		return errors.New("Not Load Tables")
-	}
+// ErrReferenceOutOfRange is reference index out of table range error
+var ErrReferenceOutOfRange = errors.New("reference index out of range")
 
-	cueTableUtf, err := NewCriUtfTable(af.base.buf, int64(cueTableField.Offset))
+func (af *CriAcbFile) initializeCueList() (err error) {
+	cueTableUtf, err := af.loadTable("CueTable")
 	if err != nil {
 		return err
 	}
-	waveformTableUtf, err := NewCriUtfTable(af.base.buf, int64(waveformTableField.Offset))
+	if cueTableUtf == nil {
+		return fmt.Errorf("%w: %s", ErrColumnNotFound, "CueTable")
+	}
+	err = af.initializeReferenceTables()
 	if err != nil {
 		return err
 	}
-	synthTableUtf, err := NewCriUtfTable(af.base.buf, int64(synthTableField.Offset))
+	err = af.initializeAisacTables()
 	if err != nil {
 		return err
 	}
-	var referenceItemsOffset, referenceItemsSize, referenceCorrection uint32 = 0, 0, 0
+
 	af.Cue = make([]CriAcbCueRecord, cueTableUtf.NumberOfRows)
-	for i := uint32(0); i < cueTableUtf.NumberOfRows; i++ {
+	for i := range af.Cue {
 		af.Cue[i].IsWaveformIdentified = false
 
-		af.Cue[i].CueID = cueTableUtf.Rows[i]["CueId"].Value.(uint32)
-		af.Cue[i].ReferenceType = cueTableUtf.Rows[i]["ReferenceType"].Value.(byte)
-		af.Cue[i].ReferenceIndex = cueTableUtf.Rows[i]["ReferenceIndex"].Value.(uint16)
-		switch af.Cue[i].ReferenceType {
-		case 2:
-			referenceItems := synthTableUtf.Rows[af.Cue[i].ReferenceIndex]["ReferenceItems"]
-			referenceItemsOffset = referenceItems.Offset
-			referenceItemsSize = referenceItems.Size
-			referenceCorrection = referenceItemsSize + 2
-		case 3, 8:
-			if i == 0 {
-				referenceItems := synthTableUtf.Rows[0]["ReferenceItems"]
-				referenceItemsOffset = referenceItems.Offset
-				referenceItemsSize = referenceItems.Size
-				referenceCorrection = referenceItemsSize - 2
-			} else {
-				referenceCorrection += 4
-			}
-		default:
-			return ErrUnexpectedReferenceType
+		cueID, err := cueTableUtf.uintValue(i, "CueId", math.MaxUint32)
+		if err != nil {
+			return err
 		}
+		referenceType, err := cueTableUtf.uintValue(i, "ReferenceType", math.MaxUint8)
+		if err != nil {
+			return err
+		}
+		referenceIndex, err := cueTableUtf.uintValue(i, "ReferenceIndex", math.MaxUint16)
+		if err != nil {
+			return err
+		}
+		af.Cue[i].CueID = uint32(cueID)
+		af.Cue[i].ReferenceType = byte(referenceType)
+		af.Cue[i].ReferenceIndex = uint16(referenceIndex)
 
-		if referenceItemsSize != 0 {
-			indexOffset := int64(referenceItemsOffset + referenceCorrection)
-			af.Cue[i].WaveformIndex, err = af.base.buf.ReadUint16FromOffset(indexOffset)
-			if err != nil {
-				return
-			}
-
-			af.Cue[i].WaveformID = waveformTableUtf.Rows[af.Cue[i].WaveformIndex]["Id"].Value.(uint16)
-			af.Cue[i].EncodeType = waveformTableUtf.Rows[af.Cue[i].WaveformIndex]["EncodeType"].Value.(byte)
+		err = af.resolveCueWaveforms(&af.Cue[i])
+		if err != nil {
+			return err
+		}
+		af.Cue[i].Aisacs = af.cueAisacs(af.Cue[i])
+		af.Cue[i].Categories = af.cueCategories(af.Cue[i])
 
-			isStreaming := waveformTableUtf.Rows[af.Cue[i].WaveformIndex]["Streaming"].Value.(byte)
-			af.Cue[i].IsStreaming = isStreaming != 0
+		if len(af.Cue[i].Waveforms) > 0 {
+			waveform := af.Cue[i].Waveforms[0]
+			af.Cue[i].WaveformIndex = waveform.Index
+			af.Cue[i].WaveformID = waveform.ID
+			af.Cue[i].EncodeType = waveform.EncodeType
+			af.Cue[i].IsStreaming = waveform.IsStreaming
 
 			af.Cue[i].IsWaveformIdentified = true
 		}
@@ -128,21 +252,28 @@ func (af *CriAcbFile) initializeCueList() (err error) {
 }
 
 func (af *CriAcbFile) initializeCueNameToWaveformMap() (err error) {
-	cueNameTableField, okCueName := af.base.Rows[0]["CueNameTable"]
-	if !okCueName {
-		return errors.New("Not Load Tables")
-	}
-
-	cueNameTableUtf, err := NewCriUtfTable(af.base.buf, int64(cueNameTableField.Offset))
+	cueNameTableUtf, err := af.loadTable("CueNameTable")
 	if err != nil {
 		return err
 	}
+	if cueNameTableUtf == nil {
+		return fmt.Errorf("%w: %s", ErrColumnNotFound, "CueNameTable")
+	}
 	af.CueNameToWaveForms = make(map[string]uint16)
-	for i := uint32(0); i < cueNameTableUtf.NumberOfRows; i++ {
-		cueIndex := cueNameTableUtf.Rows[i]["CueIndex"].Value.(uint16)
+	for i := 0; i < int(cueNameTableUtf.NumberOfRows); i++ {
+		cueIndex, err := cueNameTableUtf.Uint(i, "CueIndex")
+		if err != nil {
+			return err
+		}
+		if cueIndex >= uint64(len(af.Cue)) {
+			return ErrReferenceOutOfRange
+		}
 
 		if af.Cue[cueIndex].IsWaveformIdentified {
-			cueName := cueNameTableUtf.Rows[i]["CueName"].Value.(string)
+			cueName, err := cueNameTableUtf.String(i, "CueName")
+			if err != nil {
+				return err
+			}
 			af.Cue[cueIndex].CueName = cueName
 
 			af.CueNameToWaveForms[cueName] = af.Cue[cueIndex].WaveformID
@@ -154,69 +285,204 @@ func (af *CriAcbFile) initializeCueNameToWaveformMap() (err error) {
 // ErrAwbFileNotFound is cannot find awb file error
 var ErrAwbFileNotFound = errors.New("cannot find awb file")
 
-func (af *CriAcbFile) initializeExternalAwbArchive(basepath string) (err error) {
-	ext := filepath.Ext(basepath)
-	base := basepath[:len(basepath)-len(ext)]
-
-	formats := []string{"_streamfiles.awb", ".awb", "_STR.awb"}
+var streamAwbSuffixes = []string{"_streamfiles.awb", ".awb", "_STR.awb"}
 
-	find := false
-	var path string
-	for _, format := range formats {
-		path = base + format
-		if existsFile(path) {
-			find = true
-			break
-		}
+// streamAwbNames returns awb names of streaming awb ports
+// old acb has raw StreamAwbHash of one port, newer acb has table with Name and Hash row of each port
+func (af *CriAcbFile) streamAwbNames() ([]string, error) {
+	data, err := af.base.optionalData(0, "StreamAwbHash")
+	if err != nil {
+		return nil, err
 	}
-	if !find {
-		return ErrAwbFileNotFound
+	if !bytes.HasPrefix(data, SignatureCriUtfTable) {
+		return []string{""}, nil
 	}
-	var f *os.File
-	f, err = os.Open(path)
+	table, err := NewCriUtfTable(bytes.NewReader(data), 0)
 	if err != nil {
-		return
+		return nil, err
 	}
-	af.ExternalAwb, err = LoadCriAfs2Archive(f, 0)
-	if err != nil {
-		return
+	if table.NumberOfRows == 0 {
+		return []string{""}, nil
 	}
-
-	return nil
+	names := make([]string, table.NumberOfRows)
+	// table without Name column has hashes only
+	if !table.HasColumn("Name") {
+		return names, nil
+	}
+	for i := range names {
+		names[i], err = table.String(i, "Name")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
 }
 
-func existsFile(path string) bool {
-	_, err := os.Stat(path)
-	exists := err != nil
-	return exists
+func (af *CriAcbFile) initializeExternalAwbArchive(opts *OpenOptions) (err error) {
+	names, err := af.streamAwbNames()
+	if err != nil {
+		return err
+	}
+	af.StreamAwbs = make([]*CriAfs2Archive, len(names))
+	af.streamAwbReaders = make([]io.ReaderAt, len(names))
+	for port, name := range names {
+		r, err := af.resolveStreamAwb(opts, port, name)
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			return fmt.Errorf("%w: port %d %s", ErrAwbFileNotFound, port, name)
+		}
+		af.streamAwbReaders[port] = r
+		af.StreamAwbs[port], err = LoadCriAfs2ArchiveLazy(r, 0)
+		if err != nil {
+			return err
+		}
+	}
+	af.ExternalAwb = af.StreamAwbs[0]
+	return nil
 }
 
-// Files returns key=filename and value=data in map
-func (af *CriAcbFile) Files() map[string][]byte {
-	fileMap := make(map[string][]byte)
-	files := make(map[uint16]CriAfs2File)
-
-	if af.ExternalAwb != nil {
-		for k, v := range af.ExternalAwb.Files {
-			files[k] = v
-		}
+// resolveStreamAwb returns streaming awb reader of port, nil when it is not found
+// searched awb which does not match acb is skipped, ErrAwbMismatch is returned when no other is found
+func (af *CriAcbFile) resolveStreamAwb(opts *OpenOptions, port int, name string) (io.ReaderAt, error) {
+	if port == 0 && opts.StreamAwb != nil {
+		return opts.StreamAwb, af.checkStreamAwb(port, opts.StreamAwb, opts.VerifyHash)
 	}
-	if af.InternalAwb != nil {
-		for k, v := range af.InternalAwb.Files {
-			files[k] = v
+	if opts.Resolver != nil {
+		r, err := opts.Resolver(port, name)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			if c, ok := r.(io.Closer); ok {
+				af.closers = append(af.closers, c)
+			}
+			return r, af.checkStreamAwb(port, r, opts.VerifyHash)
 		}
 	}
+	if opts.FS == nil {
+		return nil, nil
+	}
 
-	for _, cue := range af.Cue {
-		file, ok := files[uint16(cue.CueID)]
-		if !ok {
+	// awb of named port is next to acb, port 0 is also searched by acb name
+	dir := path.Dir(opts.Name)
+	var candidates []string
+	if name != "" {
+		candidates = append(candidates, path.Join(dir, name+".awb"), path.Join(dir, name))
+	}
+	if port == 0 {
+		ext := path.Ext(opts.Name)
+		base := opts.Name[:len(opts.Name)-len(ext)]
+		for _, suffix := range streamAwbSuffixes {
+			candidates = append(candidates, base+suffix)
+		}
+	}
+	var mismatch error
+	for _, candidate := range candidates {
+		f, err := opts.FS.Open(candidate)
+		if err != nil {
 			continue
 		}
+		ra, ok := f.(io.ReaderAt)
+		if !ok {
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			ra, f = bytes.NewReader(data), nil
+		}
 
-		name := cue.CueName + cue.GetFileExtension()
-		data := file.Data
+		err = af.checkStreamAwb(port, ra, opts.VerifyHash)
+		if err != nil {
+			if f != nil {
+				f.Close()
+			}
+			if errors.Is(err, ErrAwbMismatch) {
+				mismatch = fmt.Errorf("%w (%s)", err, candidate)
+				continue
+			}
+			return nil, err
+		}
+		if f != nil {
+			af.closers = append(af.closers, f)
+		}
+		return ra, nil
+	}
+	return nil, mismatch
+}
+
+// ErrWaveformNotFound is cue waveform not found in awb error
+var ErrWaveformNotFound = errors.New("waveform not found in awb")
 
-		fileMap[name] = data
+// WaveformData returns the cue first waveform data from internal or external awb
+func (af *CriAcbFile) WaveformData(cue CriAcbCueRecord) ([]byte, error) {
+	if !cue.IsWaveformIdentified || len(cue.Waveforms) == 0 {
+		return nil, ErrWaveformNotFound
+	}
+	return af.CueWaveformData(cue.Waveforms[0])
+}
+
+// CueWaveformData returns the waveform data from internal or external awb
+func (af *CriAcbFile) CueWaveformData(waveform CriAcbCueWaveform) ([]byte, error) {
+	awb := af.waveformArchive(waveform)
+	if awb == nil {
+		return nil, ErrAwbFileNotFound
+	}
+
+	file, ok := awb.Files[waveform.ID]
+	if !ok {
+		return nil, ErrWaveformNotFound
+	}
+	return file.Bytes()
+}
+
+// HcaKeycode returns keycode mixed with subkey of awb holding the waveform
+func (af *CriAcbFile) HcaKeycode(waveform CriAcbCueWaveform, keycode uint64) uint64 {
+	return hca.MixKey(keycode, af.WaveformSubkey(waveform))
+}
+
+// WaveformSubkey returns subkey of awb holding the waveform
+func (af *CriAcbFile) WaveformSubkey(waveform CriAcbCueWaveform) uint16 {
+	awb := af.waveformArchive(waveform)
+	if awb == nil {
+		return 0
+	}
+	return awb.Subkey
+}
+
+func (af *CriAcbFile) waveformArchive(waveform CriAcbCueWaveform) *CriAfs2Archive {
+	if waveform.IsStreaming {
+		return af.StreamAwb(waveform.StreamAwbPortNo)
+	}
+	return af.InternalAwb
+}
+
+// StreamAwb returns streaming awb of port, nil when it is not loaded
+func (af *CriAcbFile) StreamAwb(port uint16) *CriAfs2Archive {
+	if port == 0 {
+		return af.ExternalAwb
+	}
+	if int(port) >= len(af.StreamAwbs) {
+		return nil
+	}
+	return af.StreamAwbs[port]
+}
+
+// Files returns key=filename and value=data in map
+func (af *CriAcbFile) Files() map[string][]byte {
+	fileMap := make(map[string][]byte)
+
+	for _, cue := range af.Cue {
+		for i, waveform := range cue.Waveforms {
+			data, err := af.CueWaveformData(waveform)
+			if err != nil {
+				continue
+			}
+
+			fileMap[cue.WaveformFileName(i)] = data
+		}
 	}
 	return fileMap
 }
@@ -0,0 +1,43 @@
+package acb
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStreamAwbNames(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		hashes  []byte
+		want    []string
+		wantErr error
+	}{
+		{"named ports", tableBytes(t, "StreamAwb", []CriUtfColumn{perrowColumn("Name", ColumnTypeString), perrowColumn("Hash", ColumnTypeData)},
+			map[string]interface{}{"Name": "bgm", "Hash": []byte{1}},
+			map[string]interface{}{"Name": "bgm_1", "Hash": []byte{2}}), []string{"bgm", "bgm_1"}, nil},
+		{"no name column", tableBytes(t, "StreamAwb", []CriUtfColumn{perrowColumn("Hash", ColumnTypeData)},
+			map[string]interface{}{"Hash": []byte{1}}), []string{""}, nil},
+		{"name is not string", tableBytes(t, "StreamAwb", []CriUtfColumn{perrowColumn("Name", ColumnType1Byte)},
+			map[string]interface{}{"Name": byte(1)}), nil, ErrColumnValueType},
+		{"raw hash", make([]byte, 16), []string{""}, nil},
+	} {
+		header := tableBytes(t, "Header", []CriUtfColumn{perrowColumn("StreamAwbHash", ColumnTypeData)},
+			map[string]interface{}{"StreamAwbHash": c.hashes})
+		base, err := NewCriUtfTable(bytes.NewReader(header), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names, err := (&CriAcbFile{base: base}).streamAwbNames()
+		if !errors.Is(err, c.wantErr) || len(names) != len(c.want) {
+			t.Errorf("%s: names = %q, %v", c.name, names, err)
+			continue
+		}
+		for i := range names {
+			if names[i] != c.want[i] {
+				t.Errorf("%s: names = %q, want %q", c.name, names, c.want)
+				break
+			}
+		}
+	}
+}
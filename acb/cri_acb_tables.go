@@ -0,0 +1,527 @@
+package acb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	referenceTypeNone          = 0
+	referenceTypeWaveform      = 1
+	referenceTypeSynth         = 2
+	referenceTypeSequence      = 3
+	referenceTypeBlockSequence = 8
+)
+
+// synth and sequence Type
+const (
+	containerTypePolyphonic         = 0
+	containerTypeSequential         = 1
+	containerTypeShuffle            = 2
+	containerTypeRandom             = 3
+	containerTypeRandomNoRepeat     = 4
+	containerTypeSwitchGameVariable = 5
+	containerTypeComboSequential    = 6
+	containerTypeSwitchSelector     = 7
+)
+
+const (
+	commandCodeEnd    = 0
+	commandCodeNoteOn = 2000
+	// commandCodeNoteOnWithNo is note on with waveform number, data starts like note on
+	commandCodeNoteOnWithNo = 2003
+
+	// commandCodeCategory data is uint16 acf category indexes
+	commandCodeCategory = 0x0041
+)
+
+// CriAcbReferenceItem is (type, index) pair in synth ReferenceItems
+type CriAcbReferenceItem struct {
+	Type  uint16
+	Index uint16
+}
+
+// CriAcbAisacReference is aisacs of synth or sequence
+// LocalAisacs are AisacTable indexes and global aisacs are range of GlobalAisacReferenceTable
+type CriAcbAisacReference struct {
+	LocalAisacs           []uint16
+	GlobalAisacStartIndex uint16
+	GlobalAisacNumRefs    uint16
+}
+
+// CriAcbSynthRecord is SynthTable row
+type CriAcbSynthRecord struct {
+	Type           byte
+	ReferenceItems []CriAcbReferenceItem
+	Commands       []CriAcbCommand
+	CriAcbAisacReference
+}
+
+// CriAcbSequenceRecord is SequenceTable row
+type CriAcbSequenceRecord struct {
+	Type       byte
+	TrackIndex []uint16
+	Commands   []CriAcbCommand
+	CriAcbAisacReference
+}
+
+// CriAcbAisacRecord is AisacTable row
+type CriAcbAisacRecord struct {
+	ControlID uint16 `utf:"ControlId,optional"`
+}
+
+// criAcbAisacControlName is AisacControlNameTable row
+type criAcbAisacControlName struct {
+	ID   uint16 `utf:"AisacControlId"`
+	Name string `utf:"AisacControlName"`
+}
+
+// criAcbGlobalAisacReference is GlobalAisacReferenceTable row
+type criAcbGlobalAisacReference struct {
+	Name string `utf:"Name"`
+}
+
+// CriAcbBlockSequenceRecord is BlockSequenceTable row
+type CriAcbBlockSequenceRecord struct {
+	TrackIndex []uint16
+	BlockIndex []uint16
+}
+
+// CriAcbBlockRecord is BlockTable row
+type CriAcbBlockRecord struct {
+	TrackIndex []uint16
+}
+
+// CriAcbTrackRecord is TrackTable row
+type CriAcbTrackRecord struct {
+	EventIndex uint16
+}
+
+// CriAcbCommand is one tlv command in TrackEventTable/CommandTable
+type CriAcbCommand struct {
+	Code uint16
+	Data []byte
+}
+
+// CriAcbTrackEventRecord is TrackEventTable (or CommandTable) row
+type CriAcbTrackEventRecord struct {
+	Commands []CriAcbCommand
+}
+
+// CriAcbWaveformFormat is audio format of waveform
+type CriAcbWaveformFormat struct {
+	NumChannels  byte
+	SamplingRate uint32
+	NumSamples   uint32
+	LoopFlag     byte
+}
+
+// Duration returns play time of samples, zero when sampling rate is unknown
+func (f CriAcbWaveformFormat) Duration() time.Duration {
+	if f.SamplingRate == 0 {
+		return 0
+	}
+	return time.Duration(uint64(f.NumSamples) * uint64(time.Second) / uint64(f.SamplingRate))
+}
+
+// CriAcbWaveformRecord is WaveformTable row
+type CriAcbWaveformRecord struct {
+	ID          uint16
+	EncodeType  byte
+	IsStreaming bool
+	CriAcbWaveformFormat
+
+	// StreamAwbPortNo is streaming awb port, MemoryAwbID and StreamAwbID are 0xFFFF when unused
+	StreamAwbPortNo uint16
+	MemoryAwbID     uint16
+	StreamAwbID     uint16
+}
+
+func containerRole(containerType byte) CriAcbWaveformRole {
+	switch containerType {
+	case containerTypePolyphonic:
+		return WaveformRoleLayer
+	case containerTypeSequential, containerTypeComboSequential:
+		return WaveformRoleSequence
+	case containerTypeShuffle, containerTypeRandom, containerTypeRandomNoRepeat:
+		return WaveformRoleRandom
+	case containerTypeSwitchGameVariable, containerTypeSwitchSelector:
+		return WaveformRoleSwitch
+	default:
+		return WaveformRoleLayer
+	}
+}
+
+func (af *CriAcbFile) loadTable(name string) (*CriUtfTable, error) {
+	return loadSubTable(af.base, name)
+}
+
+// loadSubTable returns table in data column of header row, nil when column is missing or empty
+func loadSubTable(base *CriUtfTable, name string) (*CriUtfTable, error) {
+	data, err := base.optionalData(0, name)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	// read from field value, the table may be replaced by repacking
+	return NewCriUtfTable(bytes.NewReader(data), 0)
+}
+
+func (af *CriAcbFile) initializeReferenceTables() (err error) {
+	synthTableUtf, err := af.loadTable("SynthTable")
+	if err != nil {
+		return err
+	}
+	if synthTableUtf != nil {
+		commandTableUtf, err := af.commandTable("SynthCommandTable")
+		if err != nil {
+			return err
+		}
+		af.Synths = make([]CriAcbSynthRecord, synthTableUtf.NumberOfRows)
+		for i := range af.Synths {
+			typ, err := synthTableUtf.uintValue(i, "Type", math.MaxUint8)
+			if err != nil {
+				return err
+			}
+			items, err := synthTableUtf.optionalData(i, "ReferenceItems")
+			if err != nil {
+				return err
+			}
+			af.Synths[i].Type = byte(typ)
+			af.Synths[i].ReferenceItems = parseReferenceItems(items)
+			af.Synths[i].Commands, err = referenceCommands(synthTableUtf, i, commandTableUtf)
+			if err != nil {
+				return err
+			}
+			af.Synths[i].CriAcbAisacReference, err = aisacReference(synthTableUtf, i)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	sequenceTableUtf, err := af.loadTable("SequenceTable")
+	if err != nil {
+		return err
+	}
+	if sequenceTableUtf != nil {
+		commandTableUtf, err := af.commandTable("SeqCommandTable")
+		if err != nil {
+			return err
+		}
+		af.Sequences = make([]CriAcbSequenceRecord, sequenceTableUtf.NumberOfRows)
+		for i := range af.Sequences {
+			typ, err := sequenceTableUtf.uintValue(i, "Type", math.MaxUint8)
+			if err != nil {
+				return err
+			}
+			af.Sequences[i].Type = byte(typ)
+			af.Sequences[i].TrackIndex, err = indexArray(sequenceTableUtf, i, "NumTracks", "TrackIndex")
+			if err != nil {
+				return err
+			}
+			af.Sequences[i].Commands, err = referenceCommands(sequenceTableUtf, i, commandTableUtf)
+			if err != nil {
+				return err
+			}
+			af.Sequences[i].CriAcbAisacReference, err = aisacReference(sequenceTableUtf, i)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	blockSequenceTableUtf, err := af.loadTable("BlockSequenceTable")
+	if err != nil {
+		return err
+	}
+	if blockSequenceTableUtf != nil {
+		af.BlockSequences = make([]CriAcbBlockSequenceRecord, blockSequenceTableUtf.NumberOfRows)
+		for i := range af.BlockSequences {
+			af.BlockSequences[i].TrackIndex, err = indexArray(blockSequenceTableUtf, i, "NumTracks", "TrackIndex")
+			if err != nil {
+				return err
+			}
+			af.BlockSequences[i].BlockIndex, err = indexArray(blockSequenceTableUtf, i, "NumBlocks", "BlockIndex")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	blockTableUtf, err := af.loadTable("BlockTable")
+	if err != nil {
+		return err
+	}
+	if blockTableUtf != nil {
+		af.Blocks = make([]CriAcbBlockRecord, blockTableUtf.NumberOfRows)
+		for i := range af.Blocks {
+			af.Blocks[i].TrackIndex, err = indexArray(blockTableUtf, i, "NumTracks", "TrackIndex")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	trackTableUtf, err := af.loadTable("TrackTable")
+	if err != nil {
+		return err
+	}
+	if trackTableUtf != nil {
+		af.Tracks = make([]CriAcbTrackRecord, trackTableUtf.NumberOfRows)
+		for i := range af.Tracks {
+			eventIndex, err := trackTableUtf.uintValue(i, "EventIndex", math.MaxUint16)
+			if err != nil {
+				return err
+			}
+			af.Tracks[i].EventIndex = uint16(eventIndex)
+		}
+	}
+
+	// older acb stores track events on CommandTable
+	trackEventTableUtf, err := af.loadTable("TrackEventTable")
+	if err != nil {
+		return err
+	}
+	if trackEventTableUtf == nil {
+		trackEventTableUtf, err = af.loadTable("CommandTable")
+		if err != nil {
+			return err
+		}
+	}
+	if trackEventTableUtf != nil {
+		af.TrackEvents = make([]CriAcbTrackEventRecord, trackEventTableUtf.NumberOfRows)
+		for i := range af.TrackEvents {
+			command, err := trackEventTableUtf.optionalData(i, "Command")
+			if err != nil {
+				return err
+			}
+			af.TrackEvents[i].Commands = parseCommands(command)
+		}
+	}
+
+	waveformTableUtf, err := af.loadTable("WaveformTable")
+	if err != nil {
+		return err
+	}
+	if waveformTableUtf != nil {
+		af.Waveforms = make([]CriAcbWaveformRecord, waveformTableUtf.NumberOfRows)
+		awbIDs := af.hasAwbIDs(waveformTableUtf)
+		for i := range af.Waveforms {
+			encodeType, err := waveformTableUtf.uintValue(i, "EncodeType", math.MaxUint8)
+			if err != nil {
+				return err
+			}
+			streaming, err := waveformTableUtf.Uint(i, "Streaming")
+			if err != nil {
+				return err
+			}
+			// newer acb has id of each awb instead of Id
+			idColumn := "Id"
+			if awbIDs {
+				idColumn = "MemoryAwbId"
+				if streaming != 0 {
+					idColumn = "StreamAwbId"
+				}
+			}
+			id, err := waveformTableUtf.uintValue(i, idColumn, math.MaxUint16)
+			if err != nil {
+				return err
+			}
+			af.Waveforms[i].ID = uint16(id)
+			af.Waveforms[i].EncodeType = byte(encodeType)
+			af.Waveforms[i].IsStreaming = streaming != 0
+			err = readWaveformFormat(waveformTableUtf, i, &af.Waveforms[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (af *CriAcbFile) initializeAisacTables() (err error) {
+	aisacTableUtf, err := af.loadTable("AisacTable")
+	if err != nil {
+		return err
+	}
+	if aisacTableUtf != nil {
+		err = aisacTableUtf.Unmarshal(&af.Aisacs)
+		if err != nil {
+			return err
+		}
+	}
+
+	af.AisacControlNames = make(map[uint16]string)
+	controlNameTableUtf, err := af.loadTable("AisacControlNameTable")
+	if err != nil {
+		return err
+	}
+	if controlNameTableUtf != nil {
+		var names []criAcbAisacControlName
+		err = controlNameTableUtf.Unmarshal(&names)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			af.AisacControlNames[name.ID] = name.Name
+		}
+	}
+
+	globalAisacTableUtf, err := af.loadTable("GlobalAisacReferenceTable")
+	if err != nil {
+		return err
+	}
+	if globalAisacTableUtf != nil {
+		var references []criAcbGlobalAisacReference
+		err = globalAisacTableUtf.Unmarshal(&references)
+		if err != nil {
+			return err
+		}
+		af.GlobalAisacReferences = make([]string, len(references))
+		for i, reference := range references {
+			af.GlobalAisacReferences[i] = reference.Name
+		}
+	}
+	return nil
+}
+
+// readWaveformFormat reads format and awb columns of waveform row, missing columns are zero
+// awb ids of older acb without MemoryAwbId/StreamAwbId are taken from Id
+func readWaveformFormat(tb *CriUtfTable, row int, record *CriAcbWaveformRecord) error {
+	record.MemoryAwbID, record.StreamAwbID = record.ID, 0xFFFF
+	if record.IsStreaming {
+		record.MemoryAwbID, record.StreamAwbID = record.StreamAwbID, record.MemoryAwbID
+	}
+	values := []struct {
+		name  string
+		max   uint64
+		value func(v uint64)
+	}{
+		{"NumChannels", math.MaxUint8, func(v uint64) { record.NumChannels = byte(v) }},
+		{"SamplingRate", math.MaxUint32, func(v uint64) { record.SamplingRate = uint32(v) }},
+		{"NumSamples", math.MaxUint32, func(v uint64) { record.NumSamples = uint32(v) }},
+		{"LoopFlag", math.MaxUint8, func(v uint64) { record.LoopFlag = byte(v) }},
+		{"StreamAwbPortNo", math.MaxUint16, func(v uint64) { record.StreamAwbPortNo = uint16(v) }},
+		{"MemoryAwbId", math.MaxUint16, func(v uint64) { record.MemoryAwbID = uint16(v) }},
+		{"StreamAwbId", math.MaxUint16, func(v uint64) { record.StreamAwbID = uint16(v) }},
+	}
+	for _, v := range values {
+		if !tb.HasColumn(v.name) {
+			continue
+		}
+		value, err := tb.uintValue(row, v.name, v.max)
+		if err != nil {
+			return err
+		}
+		v.value(value)
+	}
+	return nil
+}
+
+// aisacReference returns aisac columns of synth or sequence row, missing columns are empty
+func aisacReference(tb *CriUtfTable, row int) (reference CriAcbAisacReference, err error) {
+	localAisacs, err := tb.optionalData(row, "LocalAisacs")
+	if err != nil {
+		return
+	}
+	reference.LocalAisacs = parseUint16Array(localAisacs, len(localAisacs)/2)
+	if !tb.HasColumn("GlobalAisacStartIndex") || !tb.HasColumn("GlobalAisacNumRefs") {
+		return
+	}
+	start, err := tb.uintValue(row, "GlobalAisacStartIndex", math.MaxUint16)
+	if err != nil {
+		return
+	}
+	count, err := tb.uintValue(row, "GlobalAisacNumRefs", math.MaxUint16)
+	if err != nil {
+		return
+	}
+	reference.GlobalAisacStartIndex = uint16(start)
+	reference.GlobalAisacNumRefs = uint16(count)
+	return
+}
+
+// indexArray returns uint16 array of data column with count column
+func indexArray(tb *CriUtfTable, row int, countName, name string) ([]uint16, error) {
+	count, err := tb.Uint(row, countName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := tb.optionalData(row, name)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(data)/2) {
+		count = uint64(len(data) / 2)
+	}
+	return parseUint16Array(data, int(count)), nil
+}
+
+// commandTable returns command table of synth or sequence, older acb has one CommandTable
+func (af *CriAcbFile) commandTable(name string) (*CriUtfTable, error) {
+	tb, err := af.loadTable(name)
+	if err != nil || tb != nil {
+		return tb, err
+	}
+	return af.loadTable("CommandTable")
+}
+
+// referenceCommands returns commands of CommandIndex row, nil when row has no commands
+func referenceCommands(tb *CriUtfTable, row int, commandTable *CriUtfTable) ([]CriAcbCommand, error) {
+	if commandTable == nil || !tb.HasColumn("CommandIndex") {
+		return nil, nil
+	}
+	index, err := tb.uintValue(row, "CommandIndex", math.MaxUint16)
+	if err != nil {
+		return nil, err
+	}
+	if index >= uint64(commandTable.NumberOfRows) {
+		return nil, nil
+	}
+	data, err := commandTable.optionalData(int(index), "Command")
+	if err != nil {
+		return nil, err
+	}
+	return parseCommands(data), nil
+}
+
+func parseReferenceItems(data []byte) []CriAcbReferenceItem {
+	items := make([]CriAcbReferenceItem, len(data)/4)
+	for i := range items {
+		items[i].Type = binary.BigEndian.Uint16(data[i*4:])
+		items[i].Index = binary.BigEndian.Uint16(data[i*4+2:])
+	}
+	return items
+}
+
+func parseUint16Array(data []byte, count int) []uint16 {
+	if count > len(data)/2 {
+		count = len(data) / 2
+	}
+	values := make([]uint16, count)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	return values
+}
+
+// command is tlv (code uint16, size uint8, data)
+func parseCommands(data []byte) []CriAcbCommand {
+	var commands []CriAcbCommand
+	for pos := 0; pos+3 <= len(data); {
+		code := binary.BigEndian.Uint16(data[pos:])
+		size := int(data[pos+2])
+		pos += 3
+		if pos+size > len(data) {
+			break
+		}
+		commands = append(commands, CriAcbCommand{Code: code, Data: data[pos : pos+size]})
+		pos += size
+		if code == commandCodeEnd {
+			break
+		}
+	}
+	return commands
+}
@@ -0,0 +1,88 @@
+package acb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ErrAwbMismatch is streaming awb which is not the awb of acb error
+var ErrAwbMismatch = errors.New("streaming awb does not match acb")
+
+// streamAwbField returns StreamAwbAfs2Header or StreamAwbHash value of port, nil when acb has no value
+// both are raw data in old acb, or @UTF table with Header/Hash row of each port
+func (af *CriAcbFile) streamAwbField(name, column string, port int) ([]byte, error) {
+	data, err := af.base.optionalData(0, name)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, SignatureCriUtfTable) {
+		if port > 0 {
+			return nil, nil
+		}
+		return data, nil
+	}
+	table, err := NewCriUtfTable(bytes.NewReader(data), 0)
+	if err != nil {
+		return nil, err
+	}
+	if port >= int(table.NumberOfRows) || !table.HasColumn(column) {
+		return nil, nil
+	}
+	return table.Data(port, column)
+}
+
+// checkStreamAwb compares afs2 header of r with StreamAwbAfs2Header of port, and StreamAwbHash when hash
+func (af *CriAcbFile) checkStreamAwb(port int, r io.ReaderAt, hash bool) error {
+	stored, err := af.streamAwbField("StreamAwbAfs2Header", "Header", port)
+	if err != nil {
+		return err
+	}
+	// acb keeps header with padding of awb alignment
+	size := afs2HeaderSize(stored)
+	if size > len(stored) {
+		size = len(stored)
+	}
+	if size > 0 {
+		header := make([]byte, size)
+		n, _ := r.ReadAt(header, 0)
+		if n < size || !bytes.Equal(header, stored[:size]) {
+			return fmt.Errorf("%w: port %d afs2 header", ErrAwbMismatch, port)
+		}
+	}
+	if !hash {
+		return nil
+	}
+
+	storedHash, err := af.streamAwbField("StreamAwbHash", "Hash", port)
+	if err != nil || len(storedHash) != md5.Size {
+		return err
+	}
+	sum := md5.New()
+	_, err = io.Copy(sum, io.NewSectionReader(r, 0, math.MaxInt64))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sum.Sum(nil), storedHash) {
+		return fmt.Errorf("%w: port %d hash", ErrAwbMismatch, port)
+	}
+	return nil
+}
+
+// VerifyStreamAwbs compares StreamAwbAfs2Header and StreamAwbHash with each streaming awb as loaded
+// the whole awb is read, ErrAwbMismatch is returned for the first awb which differs
+func (af *CriAcbFile) VerifyStreamAwbs() error {
+	for port, r := range af.streamAwbReaders {
+		if r == nil {
+			continue
+		}
+		err := af.checkStreamAwb(port, r, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package acb
+
+import "fmt"
+
+// acb versions, header Version column is 0xMMmmbbrr (major, minor, build, revision)
+const (
+	AcbVersion106 = 0x01060100
+	AcbVersion122 = 0x01220000
+	AcbVersion127 = 0x01270000
+	AcbVersion129 = 0x01290000
+	AcbVersion130 = 0x01300000
+	AcbVersion132 = 0x01320000
+)
+
+// acbVersionAwbIDs is first version which WaveformTable has MemoryAwbId and StreamAwbId instead of Id
+const acbVersionAwbIDs = AcbVersion129
+
+// KnownAcbVersions is table of known acb versions and their waveform id columns
+var KnownAcbVersions = map[uint32]string{
+	AcbVersion106: "Id",
+	AcbVersion122: "Id",
+	AcbVersion127: "Id",
+	AcbVersion129: "MemoryAwbId, StreamAwbId",
+	AcbVersion130: "MemoryAwbId, StreamAwbId",
+	AcbVersion132: "MemoryAwbId, StreamAwbId",
+}
+
+// AcbVersionString returns version as "1.30.0.0"
+func AcbVersionString(version uint32) string {
+	return fmt.Sprintf("%x.%02x.%x.%x", version>>24, version>>16&0xFF, version>>8&0xFF, version&0xFF)
+}
+
+// Version returns Version of acb header, zero when acb has no version
+func (af *CriAcbFile) Version() uint32 {
+	return af.version
+}
+
+// hasAwbIDs reports whether waveform ids of table are MemoryAwbId and StreamAwbId
+// the column layout is used when it does not match the version
+func (af *CriAcbFile) hasAwbIDs(waveformTable *CriUtfTable) bool {
+	if !waveformTable.HasColumn("Id") {
+		return true
+	}
+	return af.version >= acbVersionAwbIDs && waveformTable.HasColumn("MemoryAwbId") && waveformTable.HasColumn("StreamAwbId")
+}
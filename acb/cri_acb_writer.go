@@ -0,0 +1,392 @@
+package acb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/vazrupe/go-acb/adx"
+	"github.com/vazrupe/go-acb/hca"
+)
+
+// ErrCueNotFound is cue name not found error
+var ErrCueNotFound = errors.New("cue not found")
+
+// ErrUnknownWaveformFormat is not hca or adx waveform error
+var ErrUnknownWaveformFormat = errors.New("unknown waveform format")
+
+// ErrWaveformIDConflict is waveform id used by other waveform in target awb error
+var ErrWaveformIDConflict = errors.New("waveform id already used in target awb")
+
+// ErrWaveformArchiveMixed is replaced waveforms which are not one awb file error
+var ErrWaveformArchiveMixed = errors.New("waveforms are in different awb files")
+
+// ErrNoAwbWriter is streaming awb writer required error
+var ErrNoAwbWriter = errors.New("streaming awb writer required")
+
+// WaveformReplacement is new waveform data and WaveformTable metadata
+type WaveformReplacement struct {
+	Data         []byte
+	EncodeType   byte
+	NumSamples   uint32
+	SamplingRate uint32
+	NumChannels  byte
+	Streaming    bool
+}
+
+// NewWaveformReplacement returns replacement with metadata read from hca or adx header
+func NewWaveformReplacement(data []byte, streaming bool) (WaveformReplacement, error) {
+	w := WaveformReplacement{Data: data, Streaming: streaming}
+	switch {
+	case hca.IsHca(data):
+		h, err := hca.ParseHeader(data)
+		if err != nil {
+			return w, err
+		}
+		w.EncodeType = waveformEncodeTypeHca
+		w.NumSamples = uint32(h.NumSamples())
+		w.SamplingRate = uint32(h.SampleRate)
+		w.NumChannels = byte(h.Channels)
+	case adx.IsAdx(data):
+		h, err := adx.ParseHeader(data)
+		if err != nil {
+			return w, err
+		}
+		w.EncodeType = waveformEncodeTypeAdx
+		w.NumSamples = uint32(h.TotalSamples)
+		w.SamplingRate = uint32(h.SampleRate)
+		w.NumChannels = byte(h.Channels)
+	default:
+		return w, ErrUnknownWaveformFormat
+	}
+	return w, nil
+}
+
+// ReplaceCueWaveform replaces i-th waveform of the cue named cueName
+// waveforms sharing the awb file are updated together
+func (af *CriAcbFile) ReplaceCueWaveform(cueName string, i int, w WaveformReplacement) error {
+	for _, cue := range af.Cue {
+		if cue.CueName != cueName {
+			continue
+		}
+		if i < 0 || i >= len(cue.Waveforms) {
+			return ErrWaveformNotFound
+		}
+		return af.ReplaceWaveform(cue.Waveforms[i], w)
+	}
+	return ErrCueNotFound
+}
+
+// ReplaceWaveform replaces awb file of waveform, waveforms sharing the awb file are updated together
+// memory awb and streaming awb of each port have their own ids
+func (af *CriAcbFile) ReplaceWaveform(waveform CriAcbCueWaveform, w WaveformReplacement) error {
+	if int(waveform.Index) >= len(af.Waveforms) {
+		return ErrWaveformNotFound
+	}
+	var rows []int
+	for i, record := range af.Waveforms {
+		if record.ID == waveform.ID && sameWaveformArchive(record, af.Waveforms[waveform.Index]) {
+			rows = append(rows, i)
+		}
+	}
+	return af.replaceWaveforms(rows, w)
+}
+
+// sameWaveformArchive reports whether both waveforms are in the same awb
+func sameWaveformArchive(a, b CriAcbWaveformRecord) bool {
+	if a.IsStreaming != b.IsStreaming {
+		return false
+	}
+	return !a.IsStreaming || a.StreamAwbPortNo == b.StreamAwbPortNo
+}
+
+func (af *CriAcbFile) replaceWaveforms(rows []int, w WaveformReplacement) error {
+	if len(rows) == 0 {
+		return ErrWaveformNotFound
+	}
+	table, err := af.loadTable("WaveformTable")
+	if err != nil {
+		return err
+	}
+	if table == nil {
+		return ErrWaveformNotFound
+	}
+	for _, row := range rows[1:] {
+		if af.Waveforms[row].ID != af.Waveforms[rows[0]].ID || !sameWaveformArchive(af.Waveforms[row], af.Waveforms[rows[0]]) {
+			return ErrWaveformArchiveMixed
+		}
+	}
+
+	id := af.Waveforms[rows[0]].ID
+	// memory waveform which becomes streaming is placed in port 0
+	port := uint16(0)
+	if af.Waveforms[rows[0]].IsStreaming {
+		port = af.Waveforms[rows[0]].StreamAwbPortNo
+	}
+	values := waveformValues(w, id, port)
+	// values are checked before awb is changed, narrow column is ErrValueOverflow
+	for _, v := range values {
+		if !table.HasColumn(v.name) {
+			continue
+		}
+		_, err = table.fitUint(v.name, v.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	target := af.InternalAwb
+	if w.Streaming {
+		// streaming awb can not be created without acb header fields
+		target = af.StreamAwb(port)
+		if target == nil {
+			return ErrAwbFileNotFound
+		}
+	}
+	if target != nil {
+		if _, ok := target.Files[id]; ok {
+			owned := false
+			for _, row := range rows {
+				owned = owned || af.Waveforms[row].IsStreaming == w.Streaming
+			}
+			if !owned {
+				return ErrWaveformIDConflict
+			}
+		}
+	} else {
+		target, err = CreateCriAfs2Archive(2, 4, 0x20, 0)
+		if err != nil {
+			return err
+		}
+		af.InternalAwb = target
+	}
+
+	for _, row := range rows {
+		record := af.Waveforms[row]
+		if awb := af.waveformArchive(CriAcbCueWaveform{IsStreaming: record.IsStreaming, StreamAwbPortNo: record.StreamAwbPortNo}); awb != nil {
+			awb.RemoveFile(id)
+		}
+	}
+	err = target.AddFile(id, w.Data)
+	if err != nil {
+		return err
+	}
+
+	memoryAwbID, streamAwbID := waveformAwbIDs(w, id)
+	for _, row := range rows {
+		for _, v := range values {
+			err = setUintValue(table, row, v.name, v.value)
+			if err != nil {
+				return err
+			}
+		}
+		record := &af.Waveforms[row]
+		record.EncodeType = w.EncodeType
+		record.IsStreaming = w.Streaming
+		record.NumChannels = w.NumChannels
+		record.SamplingRate = w.SamplingRate
+		record.NumSamples = w.NumSamples
+		record.MemoryAwbID = memoryAwbID
+		record.StreamAwbID = streamAwbID
+		if w.Streaming {
+			record.StreamAwbPortNo = port
+		}
+	}
+
+	data, err := table.Bytes()
+	if err != nil {
+		return err
+	}
+	err = af.base.SetValue(0, "WaveformTable", data)
+	if err != nil {
+		return err
+	}
+	af.updateCueWaveforms()
+	return nil
+}
+
+// waveformAwbIDs returns MemoryAwbId and StreamAwbId of waveform id, unused one is 0xFFFF
+func waveformAwbIDs(w WaveformReplacement, id uint16) (memoryAwbID, streamAwbID uint16) {
+	if w.Streaming {
+		return 0xFFFF, id
+	}
+	return id, 0xFFFF
+}
+
+// waveformValues returns WaveformTable column values of replacement
+func waveformValues(w WaveformReplacement, id, port uint16) []uintColumnValue {
+	streaming := uint64(0)
+	if w.Streaming {
+		streaming = 1
+	}
+	memoryAwbID, streamAwbID := waveformAwbIDs(w, id)
+	values := []uintColumnValue{
+		{"EncodeType", uint64(w.EncodeType)},
+		{"Streaming", streaming},
+		{"NumChannels", uint64(w.NumChannels)},
+		{"SamplingRate", uint64(w.SamplingRate)},
+		{"NumSamples", uint64(w.NumSamples)},
+		{"MemoryAwbId", uint64(memoryAwbID)},
+		{"StreamAwbId", uint64(streamAwbID)},
+	}
+	if w.Streaming {
+		values = append(values, uintColumnValue{"StreamAwbPortNo", uint64(port)})
+	}
+	return values
+}
+
+// uintColumnValue is integer value of column
+type uintColumnValue struct {
+	name  string
+	value uint64
+}
+
+// setUintValue sets integer column value, missing column is skipped
+func setUintValue(table *CriUtfTable, row int, name string, v uint64) error {
+	if !table.HasColumn(name) {
+		return nil
+	}
+	return table.SetUint(row, name, v)
+}
+
+func (af *CriAcbFile) updateCueWaveforms() {
+	for i := range af.Cue {
+		cue := &af.Cue[i]
+		for j := range cue.Waveforms {
+			waveform := &cue.Waveforms[j]
+			waveform.EncodeType = af.Waveforms[waveform.Index].EncodeType
+			waveform.IsStreaming = af.Waveforms[waveform.Index].IsStreaming
+			waveform.StreamAwbPortNo = af.Waveforms[waveform.Index].StreamAwbPortNo
+			waveform.CriAcbWaveformFormat = af.Waveforms[waveform.Index].CriAcbWaveformFormat
+		}
+		if len(cue.Waveforms) > 0 {
+			cue.EncodeType = cue.Waveforms[0].EncodeType
+			cue.IsStreaming = cue.Waveforms[0].IsStreaming
+		}
+	}
+}
+
+// Repack writes rebuilt acb to acbW and streaming awb to awbW
+// awbW must not be the streaming awb file being read, and can be nil when acb has no streaming awb
+// streaming awbs of other ports are not written, use RepackStreamAwbs
+func (af *CriAcbFile) Repack(acbW, awbW io.Writer) error {
+	return af.RepackStreamAwbs(acbW, []io.Writer{awbW})
+}
+
+// RepackStreamAwbs writes rebuilt acb to acbW and streaming awb of each port to awbWs[port]
+// awb of port beyond awbWs is not written and its acb fields are kept
+func (af *CriAcbFile) RepackStreamAwbs(acbW io.Writer, awbWs []io.Writer) error {
+	if af.InternalAwb != nil {
+		data, err := af.InternalAwb.Bytes()
+		if err != nil {
+			return err
+		}
+		// acb without memory awb gets one when memory waveform is replaced
+		if !af.base.HasColumn("AwbFile") {
+			err = af.base.AddColumn(CriUtfColumn{Name: "AwbFile", Type: ColumnTypeData, Storage: ColumnStoragePerrow})
+			if err != nil {
+				return err
+			}
+		}
+		err = af.base.SetValue(0, "AwbFile", data)
+		if err != nil {
+			return err
+		}
+	}
+
+	for port := range awbWs {
+		awb := af.StreamAwb(uint16(port))
+		if awb == nil {
+			continue
+		}
+		if awbWs[port] == nil {
+			return ErrNoAwbWriter
+		}
+		hash := md5.New()
+		_, err := awb.WriteTo(io.MultiWriter(awbWs[port], hash))
+		if err != nil {
+			return err
+		}
+		err = af.updateStreamAwbFields(port, awb, hash.Sum(nil))
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := af.base.Bytes()
+	if err != nil {
+		return err
+	}
+	_, err = acbW.Write(data)
+	return err
+}
+
+// updateStreamAwbFields sets StreamAwbAfs2Header and StreamAwbHash of port to streaming awb
+// both are raw data in old acb, or @UTF table with Header/Hash row of each port
+func (af *CriAcbFile) updateStreamAwbFields(port int, awb *CriAfs2Archive, hash []byte) error {
+	header, _, err := awb.header()
+	if err != nil {
+		return err
+	}
+
+	err = af.updateStreamAwbField("StreamAwbAfs2Header", "Header", port, func(old []byte) []byte {
+		// keep header padding of original acb
+		if len(old) > afs2HeaderSize(old) {
+			return padBytes(header, int(awb.ByteAlignment))
+		}
+		return header
+	})
+	if err != nil {
+		return err
+	}
+	return af.updateStreamAwbField("StreamAwbHash", "Hash", port, func([]byte) []byte {
+		return hash
+	})
+}
+
+func (af *CriAcbFile) updateStreamAwbField(name, column string, port int, value func(old []byte) []byte) error {
+	field, ok := af.base.Rows[0][name]
+	if !ok {
+		return nil
+	}
+	old, _ := field.Value.([]byte)
+	if len(old) == 0 {
+		return nil
+	}
+	if bytes.HasPrefix(old, sigatureAfs2Archive) || len(old) < 0x20 {
+		if port > 0 {
+			return nil
+		}
+		return af.base.SetValue(0, name, value(old))
+	}
+
+	table, err := NewCriUtfTable(bytes.NewReader(old), 0)
+	if err != nil {
+		return err
+	}
+	if port >= int(table.NumberOfRows) {
+		return nil
+	}
+	oldValue, _ := table.Rows[port][column].Value.([]byte)
+	err = table.SetValue(port, column, value(oldValue))
+	if err != nil {
+		return err
+	}
+	data, err := table.Bytes()
+	if err != nil {
+		return err
+	}
+	return af.base.SetValue(0, name, data)
+}
+
+// afs2HeaderSize returns unpadded size of afs2 header data
+func afs2HeaderSize(header []byte) int {
+	if len(header) < 0x10 {
+		return len(header)
+	}
+	count := int(binary.LittleEndian.Uint32(header[0x08:]))
+	offsetFieldSize := int(header[0x05])
+	return 0x10 + count*2 + (count+1)*offsetFieldSize
+}
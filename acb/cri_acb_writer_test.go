@@ -0,0 +1,173 @@
+package acb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"testing"
+)
+
+func perrowColumn(name string, columnType byte) CriUtfColumn {
+	return CriUtfColumn{Name: name, Type: columnType, Storage: ColumnStoragePerrow}
+}
+
+func tableBytes(t *testing.T, name string, columns []CriUtfColumn, rows ...map[string]interface{}) []byte {
+	t.Helper()
+	tb, err := CreateCriUtfTable(name, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		err = tb.AppendRow(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := tb.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func awbBytes(t *testing.T, id uint16, data string) []byte {
+	t.Helper()
+	awb, err := CreateCriAfs2Archive(2, 4, 0x20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = awb.AddFile(id, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := awb.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testAcb returns acb with cues "mem" and "str" of memory and streaming waveform 3, and its streaming awb
+func testAcb(t *testing.T) ([]byte, []byte) {
+	cue := tableBytes(t, "Cue", []CriUtfColumn{perrowColumn("CueId", ColumnType4Byte), perrowColumn("ReferenceType", ColumnType1Byte), perrowColumn("ReferenceIndex", ColumnType2Byte)},
+		map[string]interface{}{"CueId": uint32(0), "ReferenceType": byte(1), "ReferenceIndex": uint16(0)},
+		map[string]interface{}{"CueId": uint32(1), "ReferenceType": byte(1), "ReferenceIndex": uint16(1)})
+	names := tableBytes(t, "CueName", []CriUtfColumn{perrowColumn("CueName", ColumnTypeString), perrowColumn("CueIndex", ColumnType2Byte)},
+		map[string]interface{}{"CueName": "mem", "CueIndex": uint16(0)},
+		map[string]interface{}{"CueName": "str", "CueIndex": uint16(1)})
+	waveforms := tableBytes(t, "Waveform", []CriUtfColumn{perrowColumn("Id", ColumnType2Byte), perrowColumn("EncodeType", ColumnType1Byte), perrowColumn("Streaming", ColumnType1Byte)},
+		map[string]interface{}{"Id": uint16(3), "EncodeType": byte(2), "Streaming": byte(0)},
+		map[string]interface{}{"Id": uint16(3), "EncodeType": byte(2), "Streaming": byte(1)})
+	memory := awbBytes(t, 3, "memory")
+	stream := awbBytes(t, 3, "stream")
+	streamAwb, err := LoadCriAfs2Archive(bytes.NewReader(stream), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _, err := streamAwb.header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := md5.Sum(stream)
+	acbData := tableBytes(t, "Header", []CriUtfColumn{perrowColumn("CueTable", ColumnTypeData), perrowColumn("CueNameTable", ColumnTypeData), perrowColumn("WaveformTable", ColumnTypeData),
+		perrowColumn("AwbFile", ColumnTypeData), perrowColumn("StreamAwbAfs2Header", ColumnTypeData), perrowColumn("StreamAwbHash", ColumnTypeData)},
+		map[string]interface{}{"CueTable": cue, "CueNameTable": names, "WaveformTable": waveforms, "AwbFile": memory, "StreamAwbAfs2Header": header, "StreamAwbHash": hash[:]})
+	return acbData, stream
+}
+
+func TestReplaceWaveformKeepsOtherAwb(t *testing.T) {
+	acbData, stream := testAcb(t)
+	af, err := Open(bytes.NewReader(acbData), int64(len(acbData)), &OpenOptions{StreamAwb: bytes.NewReader(stream)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = af.ReplaceWaveform(af.Cue[0].Waveforms[0], WaveformReplacement{Data: []byte("new"), EncodeType: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if af.Waveforms[1].EncodeType != 2 || !af.Waveforms[1].IsStreaming {
+		t.Errorf("streaming waveform row changed: %+v", af.Waveforms[1])
+	}
+	data, err := af.WaveformData(af.Cue[1])
+	if err != nil || string(data) != "stream" {
+		t.Errorf("streaming waveform data = %q, %v", data, err)
+	}
+	data, err = af.WaveformData(af.Cue[0])
+	if err != nil || string(data) != "new" {
+		t.Errorf("memory waveform data = %q, %v", data, err)
+	}
+}
+
+func TestReplaceWaveformMixedArchives(t *testing.T) {
+	acbData, stream := testAcb(t)
+	af, err := Open(bytes.NewReader(acbData), int64(len(acbData)), &OpenOptions{StreamAwb: bytes.NewReader(stream)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = af.replaceWaveforms([]int{0, 1}, WaveformReplacement{Data: []byte("new")})
+	if err != ErrWaveformArchiveMixed {
+		t.Errorf("err = %v, want ErrWaveformArchiveMixed", err)
+	}
+}
+
+func TestRepackAddsMemoryAwb(t *testing.T) {
+	cue := tableBytes(t, "Cue", []CriUtfColumn{perrowColumn("CueId", ColumnType4Byte), perrowColumn("ReferenceType", ColumnType1Byte), perrowColumn("ReferenceIndex", ColumnType2Byte)},
+		map[string]interface{}{"CueId": uint32(0), "ReferenceType": byte(1), "ReferenceIndex": uint16(0)})
+	names := tableBytes(t, "CueName", []CriUtfColumn{perrowColumn("CueName", ColumnTypeString), perrowColumn("CueIndex", ColumnType2Byte)},
+		map[string]interface{}{"CueName": "a", "CueIndex": uint16(0)})
+	waveforms := tableBytes(t, "Waveform", []CriUtfColumn{perrowColumn("Id", ColumnType2Byte), perrowColumn("EncodeType", ColumnType1Byte), perrowColumn("Streaming", ColumnType1Byte)},
+		map[string]interface{}{"Id": uint16(0), "EncodeType": byte(2), "Streaming": byte(0)})
+	acbData := tableBytes(t, "Header", []CriUtfColumn{perrowColumn("CueTable", ColumnTypeData), perrowColumn("CueNameTable", ColumnTypeData), perrowColumn("WaveformTable", ColumnTypeData)},
+		map[string]interface{}{"CueTable": cue, "CueNameTable": names, "WaveformTable": waveforms})
+	af, err := Open(bytes.NewReader(acbData), int64(len(acbData)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = af.ReplaceCueWaveform("a", 0, WaveformReplacement{Data: []byte("memory"), EncodeType: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repacked bytes.Buffer
+	err = af.Repack(&repacked, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	af, err = Open(bytes.NewReader(repacked.Bytes()), int64(repacked.Len()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := af.WaveformData(af.Cue[0])
+	if err != nil || string(data) != "memory" {
+		t.Errorf("waveform data = %q, %v", data, err)
+	}
+}
+
+func TestReplaceWaveformSamplingRateOverflow(t *testing.T) {
+	cue := tableBytes(t, "Cue", []CriUtfColumn{perrowColumn("CueId", ColumnType4Byte), perrowColumn("ReferenceType", ColumnType1Byte), perrowColumn("ReferenceIndex", ColumnType2Byte)},
+		map[string]interface{}{"CueId": uint32(0), "ReferenceType": byte(1), "ReferenceIndex": uint16(0)})
+	waveforms := tableBytes(t, "Waveform", []CriUtfColumn{perrowColumn("Id", ColumnType2Byte), perrowColumn("EncodeType", ColumnType1Byte), perrowColumn("Streaming", ColumnType1Byte), perrowColumn("SamplingRate", ColumnType2Byte)},
+		map[string]interface{}{"Id": uint16(0), "EncodeType": byte(2), "Streaming": byte(0), "SamplingRate": uint16(48000)})
+	names := tableBytes(t, "CueName", []CriUtfColumn{perrowColumn("CueName", ColumnTypeString), perrowColumn("CueIndex", ColumnType2Byte)},
+		map[string]interface{}{"CueName": "a", "CueIndex": uint16(0)})
+	memory := awbBytes(t, 0, "memory")
+	acbData := tableBytes(t, "Header", []CriUtfColumn{perrowColumn("CueTable", ColumnTypeData), perrowColumn("CueNameTable", ColumnTypeData), perrowColumn("WaveformTable", ColumnTypeData), perrowColumn("AwbFile", ColumnTypeData)},
+		map[string]interface{}{"CueTable": cue, "CueNameTable": names, "WaveformTable": waveforms, "AwbFile": memory})
+	af, err := Open(bytes.NewReader(acbData), int64(len(acbData)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = af.ReplaceWaveform(af.Cue[0].Waveforms[0], WaveformReplacement{Data: []byte("new"), EncodeType: 2, SamplingRate: 96000})
+	if !errors.Is(err, ErrValueOverflow) {
+		t.Fatalf("err = %v, want ErrValueOverflow", err)
+	}
+	data, err := af.WaveformData(af.Cue[0])
+	if err != nil || string(data) != "memory" {
+		t.Errorf("waveform data after failed replace = %q, %v", data, err)
+	}
+	if af.Waveforms[0].SamplingRate != 48000 {
+		t.Errorf("sampling rate = %d, want 48000", af.Waveforms[0].SamplingRate)
+	}
+}
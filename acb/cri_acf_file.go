@@ -0,0 +1,232 @@
+package acb
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// CriAcfFile is Acf (atom config) file structure, acb refers its tables by index or name
+type CriAcfFile struct {
+	base *CriUtfTable
+
+	Categories    []CriAcfCategory
+	AisacControls []CriAcfAisacControl
+	GlobalAisacs  []CriAcfGlobalAisac
+	DspSettings   []CriAcfDspSetting
+	GameVariables []CriAcfGameVariable
+	Buses         []CriAcfBus
+}
+
+// CriAcfCategory is CategoryTable row
+type CriAcfCategory struct {
+	Name string `utf:"Name"`
+}
+
+// CriAcfAisacControl is AisacControlNameTable row
+type CriAcfAisacControl struct {
+	ID   uint16 `utf:"AisacControlId"`
+	Name string `utf:"AisacControlName"`
+}
+
+// CriAcfGlobalAisac is GlobalAisacTable row
+type CriAcfGlobalAisac struct {
+	Name      string `utf:"Name"`
+	ControlID uint16 `utf:"ControlId,optional"`
+}
+
+// CriAcfDspSetting is DspSettingTable row
+type CriAcfDspSetting struct {
+	Name string `utf:"Name"`
+}
+
+// CriAcfGameVariable is GameVariableTable row
+type CriAcfGameVariable struct {
+	Name  string  `utf:"Name"`
+	Value float32 `utf:"Value,optional"`
+}
+
+// CriAcfBus is BusTable row
+type CriAcfBus struct {
+	Name string `utf:"Name"`
+}
+
+// LoadCriAcfFile is load file to *CriAcfFile
+func LoadCriAcfFile(path string) (*CriAcfFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return OpenAcf(bytes.NewReader(data), int64(len(data)))
+}
+
+// LoadCriAcfFileFS is load file in fsys to *CriAcfFile
+func LoadCriAcfFileFS(fsys fs.FS, name string) (*CriAcfFile, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return OpenAcf(bytes.NewReader(data), int64(len(data)))
+}
+
+// OpenAcf is load acf from r to *CriAcfFile, missing tables are empty
+func OpenAcf(r io.ReaderAt, size int64) (acfFile *CriAcfFile, err error) {
+	r, size, err = decompressTable(r, size)
+	if err != nil {
+		return
+	}
+	acfFile = &CriAcfFile{}
+	acfFile.base, err = NewCriUtfTable(io.NewSectionReader(r, 0, size), 0)
+	if err != nil {
+		return nil, err
+	}
+	if acfFile.base.NumberOfRows == 0 {
+		return nil, ErrRowOutOfRange
+	}
+
+	tables := []struct {
+		name string
+		v    interface{}
+	}{
+		{"CategoryTable", &acfFile.Categories},
+		{"AisacControlNameTable", &acfFile.AisacControls},
+		{"GlobalAisacTable", &acfFile.GlobalAisacs},
+		{"DspSettingTable", &acfFile.DspSettings},
+		{"GameVariableTable", &acfFile.GameVariables},
+		{"BusTable", &acfFile.Buses},
+	}
+	for _, table := range tables {
+		tb, err := acfFile.Table(table.name)
+		if err != nil {
+			return nil, err
+		}
+		if tb == nil {
+			continue
+		}
+		err = tb.Unmarshal(table.v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return acfFile, nil
+}
+
+// Table returns table of acf header column, nil when acf has no table
+func (acf *CriAcfFile) Table(name string) (*CriUtfTable, error) {
+	return loadSubTable(acf.base, name)
+}
+
+// CategoryName returns name of category index, empty when index is out of range
+func (acf *CriAcfFile) CategoryName(index int) string {
+	if index < 0 || index >= len(acf.Categories) {
+		return ""
+	}
+	return acf.Categories[index].Name
+}
+
+// AisacControlName returns name of aisac control id
+func (acf *CriAcfFile) AisacControlName(id uint16) (string, bool) {
+	for _, control := range acf.AisacControls {
+		if control.ID == id {
+			return control.Name, true
+		}
+	}
+	return "", false
+}
+
+// GlobalAisac returns global aisac of name
+func (acf *CriAcfFile) GlobalAisac(name string) (CriAcfGlobalAisac, bool) {
+	for _, aisac := range acf.GlobalAisacs {
+		if aisac.Name == name {
+			return aisac, true
+		}
+	}
+	return CriAcfGlobalAisac{}, false
+}
+
+// cueAisacs returns aisacs of cue synth or sequence, control names are from acb
+func (af *CriAcbFile) cueAisacs(cue CriAcbCueRecord) []CriAcbCueAisac {
+	var reference CriAcbAisacReference
+	switch {
+	case cue.ReferenceType == referenceTypeSynth && int(cue.ReferenceIndex) < len(af.Synths):
+		reference = af.Synths[cue.ReferenceIndex].CriAcbAisacReference
+	case cue.ReferenceType == referenceTypeSequence && int(cue.ReferenceIndex) < len(af.Sequences):
+		reference = af.Sequences[cue.ReferenceIndex].CriAcbAisacReference
+	default:
+		return nil
+	}
+
+	var aisacs []CriAcbCueAisac
+	for _, index := range reference.LocalAisacs {
+		if int(index) >= len(af.Aisacs) {
+			continue
+		}
+		id := af.Aisacs[index].ControlID
+		aisacs = append(aisacs, CriAcbCueAisac{ControlID: id, ControlName: af.AisacControlNames[id]})
+	}
+	for i := 0; i < int(reference.GlobalAisacNumRefs); i++ {
+		index := int(reference.GlobalAisacStartIndex) + i
+		if index >= len(af.GlobalAisacReferences) {
+			break
+		}
+		aisacs = append(aisacs, CriAcbCueAisac{Global: true, Name: af.GlobalAisacReferences[index]})
+	}
+	return aisacs
+}
+
+// cueCategories returns category indexes set by commands of cue synth or sequence
+func (af *CriAcbFile) cueCategories(cue CriAcbCueRecord) []uint16 {
+	var commands []CriAcbCommand
+	switch {
+	case cue.ReferenceType == referenceTypeSynth && int(cue.ReferenceIndex) < len(af.Synths):
+		commands = af.Synths[cue.ReferenceIndex].Commands
+	case cue.ReferenceType == referenceTypeSequence && int(cue.ReferenceIndex) < len(af.Sequences):
+		commands = af.Sequences[cue.ReferenceIndex].Commands
+	}
+
+	var categories []uint16
+	for _, command := range commands {
+		if command.Code == commandCodeCategory {
+			categories = append(categories, parseUint16Array(command.Data, len(command.Data)/2)...)
+		}
+	}
+	return categories
+}
+
+// AttachAcf sets acf of acb, cue categories and aisac control names (and global aisac controls) are resolved by acf
+// names of previous acf are reset, nil acf detaches acf and clears category names
+func (af *CriAcbFile) AttachAcf(acf *CriAcfFile) {
+	af.Acf = acf
+	for i := range af.Cue {
+		af.Cue[i].CategoryNames = nil
+		af.Cue[i].Aisacs = af.cueAisacs(af.Cue[i])
+		if acf == nil {
+			continue
+		}
+		for _, index := range af.Cue[i].Categories {
+			af.Cue[i].CategoryNames = append(af.Cue[i].CategoryNames, acf.CategoryName(int(index)))
+		}
+		for j := range af.Cue[i].Aisacs {
+			aisac := &af.Cue[i].Aisacs[j]
+			if aisac.Global {
+				global, ok := acf.GlobalAisac(aisac.Name)
+				if !ok {
+					continue
+				}
+				aisac.ControlID = global.ControlID
+			}
+			if name, ok := acf.AisacControlName(aisac.ControlID); ok {
+				aisac.ControlName = name
+			}
+		}
+	}
+}
+
+// CategoryName returns name of category index in attached acf
+func (af *CriAcbFile) CategoryName(index int) string {
+	if af.Acf == nil {
+		return ""
+	}
+	return af.Acf.CategoryName(index)
+}
@@ -0,0 +1,77 @@
+package acb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAttachAcfCategories(t *testing.T) {
+	categoryCommand := CriAcbCommand{Code: commandCodeCategory, Data: []byte{0x00, 0x01}}
+	af := &CriAcbFile{
+		Synths: []CriAcbSynthRecord{{
+			Commands:             []CriAcbCommand{categoryCommand},
+			CriAcbAisacReference: CriAcbAisacReference{GlobalAisacNumRefs: 1},
+		}},
+		GlobalAisacReferences: []string{"global"},
+		Cue:                   []CriAcbCueRecord{{ReferenceType: referenceTypeSynth, ReferenceIndex: 0}},
+	}
+	af.Cue[0].Categories = af.cueCategories(af.Cue[0])
+	af.Cue[0].Aisacs = af.cueAisacs(af.Cue[0])
+	if len(af.Cue[0].Categories) != 1 || af.Cue[0].Categories[0] != 1 {
+		t.Fatalf("categories = %v", af.Cue[0].Categories)
+	}
+
+	acf := &CriAcfFile{
+		Categories:    []CriAcfCategory{{Name: "bgm"}, {Name: "voice"}},
+		AisacControls: []CriAcfAisacControl{{ID: 4, Name: "distance"}},
+		GlobalAisacs:  []CriAcfGlobalAisac{{Name: "global", ControlID: 4}},
+	}
+	af.AttachAcf(acf)
+	if names := af.Cue[0].CategoryNames; len(names) != 1 || names[0] != "voice" {
+		t.Errorf("category names = %v", names)
+	}
+	if aisac := af.Cue[0].Aisacs[0]; aisac.ControlID != 4 || aisac.ControlName != "distance" {
+		t.Errorf("aisac = %+v", aisac)
+	}
+
+	// names of previous acf are not kept
+	af.AttachAcf(&CriAcfFile{Categories: []CriAcfCategory{{Name: "bgm"}}})
+	if aisac := af.Cue[0].Aisacs[0]; aisac.ControlID != 0 || aisac.ControlName != "" {
+		t.Errorf("aisac after acf without global aisac = %+v", aisac)
+	}
+	af.AttachAcf(acf)
+
+	af.AttachAcf(nil)
+	if af.Acf != nil || af.Cue[0].CategoryNames != nil || af.CategoryName(0) != "" {
+		t.Errorf("acf is not detached")
+	}
+	if aisac := af.Cue[0].Aisacs[0]; aisac.ControlID != 0 || aisac.ControlName != "" {
+		t.Errorf("aisac after detach = %+v", aisac)
+	}
+}
+
+func TestReferenceCommands(t *testing.T) {
+	command := []byte{0x00, 0x41, 0x02, 0x00, 0x03, 0x00, 0x00, 0x00}
+	commands := tableBytes(t, "SynthCommand", []CriUtfColumn{perrowColumn("Command", ColumnTypeData)},
+		map[string]interface{}{"Command": command})
+	synths := tableBytes(t, "Synth", []CriUtfColumn{perrowColumn("CommandIndex", ColumnType2Byte)},
+		map[string]interface{}{"CommandIndex": uint16(0)},
+		map[string]interface{}{"CommandIndex": uint16(0xFFFF)})
+	commandTable, err := NewCriUtfTable(bytes.NewReader(commands), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthTable, err := NewCriUtfTable(bytes.NewReader(synths), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := referenceCommands(synthTable, 0, commandTable)
+	if err != nil || len(got) != 2 || got[0].Code != commandCodeCategory || !bytes.Equal(got[0].Data, []byte{0x00, 0x03}) {
+		t.Errorf("commands = %+v, %v", got, err)
+	}
+	got, err = referenceCommands(synthTable, 1, commandTable)
+	if err != nil || got != nil {
+		t.Errorf("commands of no index = %+v, %v", got, err)
+	}
+}
@@ -1,10 +1,13 @@
 package acb
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
+	"math"
 	"reflect"
+	"sort"
 
 	"github.com/vazrupe/endibuf"
 )
@@ -17,6 +20,7 @@ type CriAfs2Archive struct {
 	Version       []byte
 	FileCount     uint32
 	ByteAlignment uint32
+	Subkey        uint16
 	Files         map[uint16]CriAfs2File
 }
 
@@ -27,6 +31,24 @@ type CriAfs2File struct {
 	FileOffsetByteAligned int64
 	FileLength            int64
 	Data                  []byte
+
+	section *io.SectionReader
+}
+
+// Open returns reader of file data
+func (f CriAfs2File) Open() *io.SectionReader {
+	if f.section == nil {
+		return io.NewSectionReader(bytes.NewReader(f.Data), 0, int64(len(f.Data)))
+	}
+	return io.NewSectionReader(f.section, 0, f.section.Size())
+}
+
+// Bytes returns file data, lazy loaded file is read from archive
+func (f CriAfs2File) Bytes() ([]byte, error) {
+	if f.Data != nil {
+		return f.Data, nil
+	}
+	return io.ReadAll(f.Open())
 }
 
 // ErrFileCountExceeds is error (file count exceeds max value for uint16)
@@ -39,6 +61,40 @@ var ErrNoAfs2Header = errors.New("no afs2 archive header")
 func LoadCriAfs2Archive(buf io.ReadSeeker, offset int64) (arh *CriAfs2Archive, err error) {
 	r := endibuf.NewReader(buf)
 	r.Endian = binary.LittleEndian
+	arh, err = loadCriAfs2Header(r, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, file := range arh.Files {
+		file.Data, err = r.ReadBytesFromOffset(file.FileOffsetByteAligned, int(file.FileLength))
+		if err != nil {
+			return nil, err
+		}
+		arh.Files[id] = file
+	}
+
+	return
+}
+
+// LoadCriAfs2ArchiveLazy is Afs2 header load from readerat, file data is read on demand
+func LoadCriAfs2ArchiveLazy(buf io.ReaderAt, offset int64) (arh *CriAfs2Archive, err error) {
+	r := endibuf.NewReader(io.NewSectionReader(buf, 0, math.MaxInt64))
+	r.Endian = binary.LittleEndian
+	arh, err = loadCriAfs2Header(r, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, file := range arh.Files {
+		file.section = io.NewSectionReader(buf, file.FileOffsetByteAligned, file.FileLength)
+		arh.Files[id] = file
+	}
+
+	return
+}
+
+func loadCriAfs2Header(r *endibuf.Reader, offset int64) (arh *CriAfs2Archive, err error) {
 	arh = &CriAfs2Archive{}
 
 	arh.Signature, err = r.ReadBytesFromOffset(offset, 4)
@@ -68,7 +124,13 @@ func LoadCriAfs2Archive(buf io.ReadSeeker, offset int64) (arh *CriAfs2Archive, e
 		return nil, ErrFileCountExceeds
 	}
 
-	arh.ByteAlignment, err = r.ReadUint32FromOffset(offset + 0xC)
+	byteAlignment, err := r.ReadUint16FromOffset(offset + 0xC)
+	if err != nil {
+		return nil, err
+	}
+	arh.ByteAlignment = uint32(byteAlignment)
+	// hca key is mixed with subkey
+	arh.Subkey, err = r.ReadUint16FromOffset(offset + 0xE)
 	if err != nil {
 		return nil, err
 	}
@@ -90,15 +152,9 @@ func LoadCriAfs2Archive(buf io.ReadSeeker, offset int64) (arh *CriAfs2Archive, e
 		// mask off unneeded info
 		fileOffsetRaw &= uint32(offsetMask)
 
-		// add offset
+		// set file offset to byte alignment (alignment is relative to archive start)
 		dummy.FileOffsetRaw = offset + int64(fileOffsetRaw)
-
-		// set file offset to byte alignment
-		if (dummy.FileOffsetRaw & int64(arh.ByteAlignment)) != 0 {
-			dummy.FileOffsetByteAligned = roundUpToByteAlignment(dummy.FileOffsetRaw, int64(arh.ByteAlignment))
-		} else {
-			dummy.FileOffsetByteAligned = dummy.FileOffsetRaw
-		}
+		dummy.FileOffsetByteAligned = offset + roundUpToByteAlignment(int64(fileOffsetRaw), int64(arh.ByteAlignment))
 
 		// set file size
 		// last file will use final offset entry
@@ -108,6 +164,7 @@ func LoadCriAfs2Archive(buf io.ReadSeeker, offset int64) (arh *CriAfs2Archive, e
 			if err != nil {
 				return nil, err
 			}
+			fileLength &= uint32(offsetMask)
 			dummy.FileLength = int64(fileLength) + offset - dummy.FileOffsetByteAligned
 		}
 
@@ -122,24 +179,150 @@ func LoadCriAfs2Archive(buf io.ReadSeeker, offset int64) (arh *CriAfs2Archive, e
 		previousCueID = dummy.CueID
 	}
 
-	for id, file := range arh.Files {
-		file.Data, err = r.ReadBytesFromOffset(file.FileOffsetByteAligned, int(file.FileLength))
+	return
+}
+
+// ErrOffsetFieldSize is unsupported afs2 offset field size error
+var ErrOffsetFieldSize = errors.New("afs2 offset field size must be 2 or 4")
+
+// ErrOffsetExceeds is error (file offset exceeds offset field size)
+var ErrOffsetExceeds = errors.New("file offset exceeds offset field size")
+
+// CreateCriAfs2Archive returns empty Afs2 archive for writing
+func CreateCriAfs2Archive(version, offsetFieldSize byte, byteAlignment uint32, subkey uint16) (*CriAfs2Archive, error) {
+	if offsetFieldSize != 2 && offsetFieldSize != 4 {
+		return nil, ErrOffsetFieldSize
+	}
+	return &CriAfs2Archive{
+		Signature:     sigatureAfs2Archive,
+		Version:       []byte{version, offsetFieldSize, 2, 0},
+		ByteAlignment: byteAlignment,
+		Subkey:        subkey,
+		Files:         make(map[uint16]CriAfs2File),
+	}, nil
+}
+
+// AddFile adds or replaces file of id
+func (arh *CriAfs2Archive) AddFile(id uint16, data []byte) error {
+	if _, ok := arh.Files[id]; !ok && len(arh.Files) >= 0xFFFF {
+		return ErrFileCountExceeds
+	}
+	arh.Files[id] = CriAfs2File{CueID: id, FileLength: int64(len(data)), Data: data}
+	arh.FileCount = uint32(len(arh.Files))
+	return nil
+}
+
+// RemoveFile removes file of id
+func (arh *CriAfs2Archive) RemoveFile(id uint16) {
+	delete(arh.Files, id)
+	arh.FileCount = uint32(len(arh.Files))
+}
+
+// IDs returns sorted file ids
+func (arh *CriAfs2Archive) IDs() []uint16 {
+	ids := make([]uint16, 0, len(arh.Files))
+	for id := range arh.Files {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// WriteTo writes Afs2 archive to w, files are sorted by id
+func (arh *CriAfs2Archive) WriteTo(w io.Writer) (n int64, err error) {
+	header, offsets, err := arh.header()
+	if err != nil {
+		return 0, err
+	}
+	written, err := w.Write(header)
+	n += int64(written)
+	if err != nil {
+		return
+	}
+	alignment := int64(arh.ByteAlignment)
+	for i, id := range arh.IDs() {
+		padding := roundUpToByteAlignment(offsets[i], alignment) - offsets[i]
+		written, err = w.Write(make([]byte, padding))
+		n += int64(written)
 		if err != nil {
-			return nil, err
+			return
 		}
-		// remove zeros
-		for i, d := range file.Data {
-			if d > 0 {
-				file.Data = file.Data[i:]
-				break
-			}
+		file := arh.Files[id]
+		var copied int64
+		copied, err = io.Copy(w, file.Open())
+		n += copied
+		if err != nil {
+			return
 		}
-		arh.Files[id] = file
+		if copied != file.FileLength {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return
+}
+
+// header returns afs2 header and offset table values
+func (arh *CriAfs2Archive) header() (header []byte, offsets []int64, err error) {
+	if len(arh.Files) > 0xFFFF {
+		return nil, nil, ErrFileCountExceeds
+	}
+	version := []byte{2, 4, 2, 0}
+	if len(arh.Version) == 4 {
+		copy(version, arh.Version)
+	}
+	offsetFieldSize := int64(version[1])
+	if offsetFieldSize != 2 && offsetFieldSize != 4 {
+		return nil, nil, ErrOffsetFieldSize
+	}
+	alignment := int64(arh.ByteAlignment)
+	ids := arh.IDs()
+	fileCount := int64(len(ids))
+
+	// offset table has file starts (unaligned) and archive end
+	headerSize := 0x10 + fileCount*2 + (fileCount+1)*offsetFieldSize
+	offsets = make([]int64, fileCount+1)
+	offsets[0] = headerSize
+	for i, id := range ids {
+		start := roundUpToByteAlignment(offsets[i], alignment)
+		offsets[i+1] = start + arh.Files[id].FileLength
+	}
+	if offsetFieldSize == 2 && offsets[fileCount] > 0xFFFF || offsets[fileCount] > math.MaxUint32 {
+		return nil, nil, ErrOffsetExceeds
 	}
 
+	header = make([]byte, headerSize)
+	copy(header, sigatureAfs2Archive)
+	copy(header[4:], version)
+	binary.LittleEndian.PutUint32(header[0x08:], uint32(fileCount))
+	binary.LittleEndian.PutUint16(header[0x0C:], uint16(arh.ByteAlignment))
+	binary.LittleEndian.PutUint16(header[0x0E:], arh.Subkey)
+	for i, id := range ids {
+		binary.LittleEndian.PutUint16(header[0x10+i*2:], id)
+	}
+	offsetTable := header[0x10+fileCount*2:]
+	for i, offset := range offsets {
+		if offsetFieldSize == 2 {
+			binary.LittleEndian.PutUint16(offsetTable[int64(i)*2:], uint16(offset))
+		} else {
+			binary.LittleEndian.PutUint32(offsetTable[int64(i)*4:], uint32(offset))
+		}
+	}
 	return
 }
 
+// Bytes returns Afs2 archive data
+func (arh *CriAfs2Archive) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := arh.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func roundUpToByteAlignment(valueToRound, byteAlignment int64) int64 {
+	if byteAlignment <= 1 {
+		return valueToRound
+	}
 	return (valueToRound + byteAlignment - 1) / byteAlignment * byteAlignment
 }
@@ -0,0 +1,427 @@
+package acb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrConstantColumnValue is row value of zero or constant column which differs from the column value error
+var ErrConstantColumnValue = errors.New("row value differs from zero or constant column")
+
+var columnTypeNames = map[byte]string{
+	ColumnTypeString: "string",
+	ColumnType8Byte:  "uint64",
+	ColumnTypeData:   "data",
+	ColumnTypeFloat:  "float",
+	ColumnType4Byte2: "int32",
+	ColumnType4Byte:  "uint32",
+	ColumnType2Byte2: "int16",
+	ColumnType2Byte:  "uint16",
+	ColumnType1Byte2: "int8",
+	ColumnType1Byte:  "uint8",
+}
+
+var columnStorageNames = map[byte]string{
+	ColumnStorageZero:      "zero",
+	ColumnStorageConstant:  "constant",
+	ColumnStorageConstant2: "constant2",
+	ColumnStoragePerrow:    "perrow",
+}
+
+// TypeName returns column type name (uint8, int8, ... string, data)
+func (c CriUtfColumn) TypeName() string {
+	if name, ok := columnTypeNames[c.Type]; ok {
+		return name
+	}
+	return "type-" + strconv.Itoa(int(c.Type))
+}
+
+// StorageName returns column storage name (zero, constant, constant2, perrow)
+func (c CriUtfColumn) StorageName() string {
+	if name, ok := columnStorageNames[c.Storage]; ok {
+		return name
+	}
+	return "storage-" + strconv.Itoa(int(c.Storage))
+}
+
+// DecodeNestedTable returns @UTF table in data column value, nil when data is not @UTF table
+func DecodeNestedTable(data []byte) *CriUtfTable {
+	if !bytes.HasPrefix(data, SignatureCriUtfTable) {
+		return nil
+	}
+	table, err := NewCriUtfTable(bytes.NewReader(data), 0)
+	if err != nil {
+		return nil
+	}
+	return table
+}
+
+// NestedTable returns @UTF table in data column value which json can keep as table
+// nil when DecodeNestedTable fails or the table is not rewritten identically
+func NestedTable(data []byte) *CriUtfTable {
+	table := DecodeNestedTable(data)
+	if table == nil {
+		return nil
+	}
+	rewritten, err := table.Bytes()
+	if err != nil || !bytes.Equal(rewritten, data) {
+		return nil
+	}
+	return table
+}
+
+// MarshalJSON returns table as json, columns and rows keep column order
+// data column is base64 string, or nested table object when NestedTable decodes it
+func (tb *CriUtfTable) MarshalJSON() ([]byte, error) {
+	return tb.marshalJSON(NestedTable)
+}
+
+// DumpJSON returns table as json like MarshalJSON, but every data column DecodeNestedTable decodes is
+// nested table object. the json is for reading, JSONToUtf of it may not give the same data
+func (tb *CriUtfTable) DumpJSON() ([]byte, error) {
+	return tb.marshalJSON(DecodeNestedTable)
+}
+
+// marshalJSON returns table as json, nested returns table of data column value or nil
+func (tb *CriUtfTable) marshalJSON(nested func([]byte) *CriUtfTable) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"TableName":`)
+	writeJSONString(&buf, tb.TableName)
+	buf.WriteString(`,"Unknown1":`)
+	buf.WriteString(strconv.FormatUint(uint64(tb.Unknown1), 10))
+	if tb.IsEncrypt {
+		buf.WriteString(`,"Seed":`)
+		buf.WriteString(strconv.Itoa(int(tb.Seek)))
+		buf.WriteString(`,"Increment":`)
+		buf.WriteString(strconv.Itoa(int(tb.Increment)))
+	}
+	buf.WriteString(`,"DataAlignment":`)
+	buf.WriteString(strconv.FormatUint(uint64(tb.DataAlignment), 10))
+	buf.WriteString(`,"RowSize":`)
+	buf.WriteString(strconv.FormatUint(uint64(tb.RowSize), 10))
+
+	buf.WriteString(`,"Columns":[`)
+	for i, column := range tb.Columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"Name":`)
+		writeJSONString(&buf, column.Name)
+		buf.WriteString(`,"Type":"`)
+		buf.WriteString(column.TypeName())
+		buf.WriteString(`","Storage":"`)
+		buf.WriteString(column.StorageName())
+		buf.WriteByte('"')
+		if column.Storage == ColumnStorageConstant || column.Storage == ColumnStorageConstant2 {
+			buf.WriteString(`,"Constant":`)
+			err := writeJSONValue(&buf, column.Constant, nested)
+			if err != nil {
+				return nil, err
+			}
+		}
+		buf.WriteByte('}')
+	}
+
+	buf.WriteString(`],"Rows":[`)
+	for i, row := range tb.Rows {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('{')
+		n := 0
+		for _, column := range tb.Columns {
+			if column.Storage != ColumnStoragePerrow {
+				continue
+			}
+			if n > 0 {
+				buf.WriteByte(',')
+			}
+			n++
+			writeJSONString(&buf, column.Name)
+			buf.WriteByte(':')
+			err := writeJSONValue(&buf, row[column.Name], nested)
+			if err != nil {
+				return nil, err
+			}
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes(), nil
+}
+
+// writeJSONString writes s as json string, invalid utf-8 is {"Base64":"..."}
+func writeJSONString(buf *bytes.Buffer, s string) {
+	if !utf8.ValidString(s) {
+		buf.WriteString(`{"Base64":"`)
+		buf.WriteString(base64.StdEncoding.EncodeToString([]byte(s)))
+		buf.WriteString(`"}`)
+		return
+	}
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+func writeJSONValue(buf *bytes.Buffer, field CriField, nested func([]byte) *CriUtfTable) error {
+	switch v := field.Value.(type) {
+	case string:
+		writeJSONString(buf, v)
+	case float32:
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			buf.WriteString(`"` + strconv.FormatFloat(f, 'g', -1, 32) + `"`)
+		} else {
+			buf.WriteString(strconv.FormatFloat(f, 'g', -1, 32))
+		}
+	case []byte:
+		if table := nested(v); table != nil {
+			b, err := table.marshalJSON(nested)
+			if err != nil {
+				return err
+			}
+			buf.Write(b)
+			return nil
+		}
+		buf.WriteByte('"')
+		buf.WriteString(base64.StdEncoding.EncodeToString(v))
+		buf.WriteByte('"')
+	default:
+		n, err := field.Int()
+		if err == ErrValueOverflow {
+			u, _ := field.Uint()
+			buf.WriteString(strconv.FormatUint(u, 10))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatInt(n, 10))
+	}
+	return nil
+}
+
+// jsonTable is json form of table written by MarshalJSON
+type jsonTable struct {
+	TableName     json.RawMessage
+	Unknown1      uint16
+	Seed          *byte
+	Increment     *byte
+	DataAlignment uint32
+	Columns       []struct {
+		Name     json.RawMessage
+		Type     string
+		Storage  string
+		Constant json.RawMessage
+	}
+	Rows []map[string]json.RawMessage
+}
+
+// UnmarshalJSON sets table from json written by MarshalJSON
+// row value of zero or constant column must be the column value, or ErrConstantColumnValue is returned
+func (tb *CriUtfTable) UnmarshalJSON(data []byte) error {
+	var src jsonTable
+	err := json.Unmarshal(data, &src)
+	if err != nil {
+		return err
+	}
+	name, err := readJSONString(src.TableName)
+	if err != nil {
+		return err
+	}
+
+	columns := make([]CriUtfColumn, len(src.Columns))
+	for i, c := range src.Columns {
+		column := &columns[i]
+		column.Name, err = readJSONString(c.Name)
+		if err != nil {
+			return err
+		}
+		column.Type, err = columnByName(columnTypeNames, c.Type, ErrUnknownColumnType)
+		if err != nil {
+			return err
+		}
+		column.Storage, err = columnByName(columnStorageNames, c.Storage, ErrUnknownColumnStorage)
+		if err != nil {
+			return err
+		}
+		if column.Storage == ColumnStorageConstant || column.Storage == ColumnStorageConstant2 {
+			column.Constant.Value, err = readJSONValue(column.Type, c.Constant)
+			if err != nil {
+				return fmt.Errorf("%w: %s.%s", err, name, column.Name)
+			}
+		}
+	}
+
+	table, err := CreateCriUtfTable(name, columns)
+	if err != nil {
+		return err
+	}
+	for _, row := range src.Rows {
+		values := make(map[string]interface{}, len(row))
+		for key, raw := range row {
+			values[key] = raw
+		}
+		for _, column := range table.Columns {
+			raw, ok := row[column.Name]
+			if !ok {
+				continue
+			}
+			values[column.Name], err = readJSONValue(column.Type, raw)
+			if err != nil {
+				return fmt.Errorf("%w: %s.%s", err, name, column.Name)
+			}
+			// zero and constant column value is in schema, row can not change it
+			if column.Storage != ColumnStoragePerrow && !sameColumnValue(values[column.Name], column.Constant.Value) {
+				return fmt.Errorf("%w: %s.%s", ErrConstantColumnValue, name, column.Name)
+			}
+		}
+		err = table.AppendRow(values)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, name)
+		}
+	}
+
+	table.Unknown1 = src.Unknown1
+	if src.DataAlignment > 0 {
+		table.DataAlignment = src.DataAlignment
+	}
+	if src.Seed != nil && src.Increment != nil {
+		table.IsEncrypt = true
+		table.Seek = *src.Seed
+		table.Increment = *src.Increment
+	}
+	*tb = *table
+	return nil
+}
+
+// sameColumnValue reports whether both column values are the same, any NaN is the same
+func sameColumnValue(a, b interface{}) bool {
+	switch v := a.(type) {
+	case []byte:
+		w, ok := b.([]byte)
+		return ok && bytes.Equal(v, w)
+	case float32:
+		w, ok := b.(float32)
+		return ok && (math.Float32bits(v) == math.Float32bits(w) || v != v && w != w)
+	}
+	return a == b
+}
+
+func columnByName(names map[byte]string, name string, notFound error) (byte, error) {
+	for value, n := range names {
+		if n == name {
+			return value, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", notFound, name)
+}
+
+// readJSONString reads json string or {"Base64":"..."} of invalid utf-8 string
+func readJSONString(raw json.RawMessage) (string, error) {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s, nil
+	}
+	var b struct{ Base64 []byte }
+	err := json.Unmarshal(raw, &b)
+	if err != nil {
+		return "", ErrColumnValueType
+	}
+	return string(b.Base64), nil
+}
+
+func readJSONValue(columnType byte, raw json.RawMessage) (interface{}, error) {
+	text := string(bytes.TrimSpace(raw))
+	if text == "" || text == "null" {
+		return zeroColumnValue(columnType), nil
+	}
+	switch columnType {
+	case ColumnTypeString:
+		return readJSONString(raw)
+	case ColumnTypeData:
+		if text[0] == '{' {
+			var nested CriUtfTable
+			err := nested.UnmarshalJSON(raw)
+			if err != nil {
+				return nil, err
+			}
+			return nested.Bytes()
+		}
+		var data []byte
+		err := json.Unmarshal(raw, &data)
+		if err != nil {
+			return nil, ErrColumnValueType
+		}
+		if data == nil {
+			data = []byte{}
+		}
+		return data, nil
+	case ColumnTypeFloat:
+		text = strings.Trim(text, `"`)
+		v, err := strconv.ParseFloat(text, 32)
+		if err != nil {
+			return nil, ErrColumnValueType
+		}
+		return float32(v), nil
+	case ColumnType4Byte2, ColumnType2Byte2, ColumnType1Byte2:
+		bits := int(columnTypeSize(columnType) * 8)
+		v, err := strconv.ParseInt(text, 10, bits)
+		if err != nil {
+			return nil, ErrColumnValueType
+		}
+		return columnValueFromUint(columnType, uint64(v))
+	default:
+		bits := int(columnTypeSize(columnType) * 8)
+		v, err := strconv.ParseUint(text, 10, bits)
+		if err != nil {
+			return nil, ErrColumnValueType
+		}
+		return columnValueFromUint(columnType, v)
+	}
+}
+
+// ErrNotIdentical is table which is not rewritten to identical data error
+var ErrNotIdentical = errors.New("table is not rewritten identically")
+
+// UtfToJSON returns indented json of @UTF table data
+// json is returned with ErrNotIdentical when JSONToUtf of it will differ from data
+func UtfToJSON(data []byte) ([]byte, error) {
+	table, err := NewCriUtfTable(bytes.NewReader(data), 0)
+	if err != nil {
+		return nil, err
+	}
+	var identical error
+	rewritten, err := table.Bytes()
+	if err != nil || !bytes.Equal(rewritten, data) {
+		identical = ErrNotIdentical
+	}
+	compact, err := table.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = json.Indent(&buf, compact, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), identical
+}
+
+// JSONToUtf returns @UTF table data of json written by UtfToJSON
+// untouched json is converted back to identical data
+func JSONToUtf(data []byte) ([]byte, error) {
+	var table CriUtfTable
+	err := table.UnmarshalJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return table.Bytes()
+}
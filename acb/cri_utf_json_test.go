@@ -0,0 +1,146 @@
+package acb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// jsonTestTable returns encrypted table with nested table, invalid utf-8 strings, nan float and zero/constant columns
+func jsonTestTable(t *testing.T) []byte {
+	nested := tableBytes(t, "Nested", []CriUtfColumn{perrowColumn("Value", ColumnType2Byte)},
+		map[string]interface{}{"Value": uint16(5)})
+	columns := []CriUtfColumn{
+		perrowColumn("Name", ColumnTypeString),
+		{Name: "Constant", Type: ColumnTypeFloat, Storage: ColumnStorageConstant, Constant: CriField{Value: float32(math.NaN())}},
+		perrowColumn("Uint64", ColumnType8Byte),
+		perrowColumn("Data", ColumnTypeData),
+		perrowColumn("Float", ColumnTypeFloat),
+		perrowColumn("Int32", ColumnType4Byte2),
+		{Name: "Zero", Type: ColumnType4Byte, Storage: ColumnStorageZero},
+		perrowColumn("Int16", ColumnType2Byte2),
+		{Name: "Table", Type: ColumnTypeData, Storage: ColumnStorageConstant2, Constant: CriField{Value: nested}},
+	}
+	tb, err := CreateCriUtfTable("Table\x82\xa0", columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []map[string]interface{}{
+		{"Name": "\x93\xfa", "Uint64": uint64(math.MaxUint64), "Data": []byte{1, 2}, "Float": float32(math.Inf(-1)), "Int32": int32(-7), "Int16": int16(-300)},
+		{"Name": "ok", "Data": nested, "Float": float32(0.1)},
+	}
+	for _, row := range rows {
+		err = tb.AppendRow(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tb.IsEncrypt, tb.Seek, tb.Increment = true, 0x5f, 0x15
+	data, err := tb.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUtfJSONRoundTrip(t *testing.T) {
+	data := jsonTestTable(t)
+	j, err := UtfToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Seed": 95`, `"Base64"`, `"NaN"`, `"-Inf"`, `"TableName": "Nested"`, `"Storage": "zero"`} {
+		if !bytes.Contains(j, []byte(want)) {
+			t.Errorf("json has no %s\n%s", want, j)
+		}
+	}
+	rewritten, err := JSONToUtf(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rewritten, data) {
+		t.Errorf("round trip is not identical\n%s", j)
+	}
+}
+
+func TestUtfToJSONNotIdentical(t *testing.T) {
+	data := tableBytes(t, "Table", []CriUtfColumn{perrowColumn("Value", ColumnType2Byte)},
+		map[string]interface{}{"Value": uint16(5)})
+	// extra padding is not written again
+	padded := append(append([]byte{}, data...), make([]byte, 8)...)
+	binary.BigEndian.PutUint32(padded[4:], uint32(len(padded)-8))
+
+	j, err := UtfToJSON(padded)
+	if !errors.Is(err, ErrNotIdentical) || j == nil {
+		t.Fatalf("err = %v, json = %s", err, j)
+	}
+	rewritten, err := JSONToUtf(j)
+	if err != nil || !bytes.Equal(rewritten, data) {
+		t.Errorf("json of padded table = %x, %v", rewritten, err)
+	}
+}
+
+func TestNestedTablePadded(t *testing.T) {
+	data := tableBytes(t, "Table", []CriUtfColumn{perrowColumn("Value", ColumnType2Byte)},
+		map[string]interface{}{"Value": uint16(5)})
+	padded := append(append([]byte{}, data...), make([]byte, 8)...)
+	binary.BigEndian.PutUint32(padded[4:], uint32(len(padded)-8))
+
+	if table := DecodeNestedTable(padded); table == nil || table.TableName != "Table" {
+		t.Errorf("DecodeNestedTable = %+v", table)
+	}
+	if table := NestedTable(padded); table != nil {
+		t.Errorf("NestedTable of padded table = %+v, want nil", table)
+	}
+	if table := DecodeNestedTable([]byte("data")); table != nil {
+		t.Errorf("DecodeNestedTable of data = %+v, want nil", table)
+	}
+}
+
+func TestDumpJSONDecodesPaddedTable(t *testing.T) {
+	data := tableBytes(t, "Inner", []CriUtfColumn{perrowColumn("Value", ColumnType2Byte)},
+		map[string]interface{}{"Value": uint16(5)})
+	padded := append(append([]byte{}, data...), make([]byte, 8)...)
+	binary.BigEndian.PutUint32(padded[4:], uint32(len(padded)-8))
+	tb, err := CreateCriUtfTable("Outer", []CriUtfColumn{perrowColumn("Table", ColumnTypeData)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tb.AppendRow(map[string]interface{}{"Table": padded})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dumped, err := tb.DumpJSON()
+	if err != nil || !bytes.Contains(dumped, []byte(`"TableName":"Inner"`)) {
+		t.Errorf("DumpJSON = %s, %v", dumped, err)
+	}
+	marshaled, err := tb.MarshalJSON()
+	if err != nil || bytes.Contains(marshaled, []byte(`"TableName":"Inner"`)) {
+		t.Errorf("MarshalJSON of padded table = %s, %v, want base64", marshaled, err)
+	}
+}
+
+func TestJSONToUtfConstantColumnValue(t *testing.T) {
+	const schema = `{"TableName":"Table","Unknown1":0,"DataAlignment":0,"RowSize":0,"Columns":[` +
+		`{"Name":"Zero","Type":"uint16","Storage":"zero"},` +
+		`{"Name":"Constant","Type":"string","Storage":"constant","Constant":"value"},` +
+		`{"Name":"Value","Type":"uint8","Storage":"perrow"}],"Rows":[%s]}`
+	for _, c := range []struct {
+		row string
+		err error
+	}{
+		{`{"Value":1}`, nil},
+		{`{"Zero":0,"Constant":"value","Value":1}`, nil},
+		{`{"Zero":2,"Value":1}`, ErrConstantColumnValue},
+		{`{"Constant":"edited","Value":1}`, ErrConstantColumnValue},
+	} {
+		_, err := JSONToUtf([]byte(fmt.Sprintf(schema, c.row)))
+		if !errors.Is(err, c.err) {
+			t.Errorf("row %s: err = %v, want %v", c.row, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package acb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// ErrUnmarshalTarget is unsupported unmarshal target error
+var ErrUnmarshalTarget = errors.New("unmarshal target must be pointer to struct or slice of struct")
+
+// ErrUnsupportedFieldType is struct field type without column type error
+var ErrUnsupportedFieldType = errors.New("unsupported struct field type")
+
+// structColumn is struct field mapped to column by `utf:"Name[,optional]"` tag
+type structColumn struct {
+	index    int
+	name     string
+	optional bool
+}
+
+func structColumns(t reflect.Type) []structColumn {
+	var columns []structColumn
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		column := structColumn{index: i, name: field.Name}
+		if tag, ok := field.Tag.Lookup("utf"); ok {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				column.name = parts[0]
+			}
+			for _, option := range parts[1:] {
+				column.optional = column.optional || option == "optional"
+			}
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// Unmarshal stores rows to v
+// v is pointer to slice of struct (all rows) or pointer to struct (first row)
+// struct fields are mapped by `utf:"Name"` tag (or field name), `utf:"Name,optional"` allows missing column
+// and `utf:"-"` is skipped. integers are widened, data column of @UTF table is decoded to struct or slice field
+func (tb *CriUtfTable) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrUnmarshalTarget
+	}
+	rv = rv.Elem()
+	switch {
+	case rv.Kind() == reflect.Struct:
+		if len(tb.Rows) == 0 {
+			return ErrRowOutOfRange
+		}
+		return tb.unmarshalRow(0, rv)
+	case rv.Kind() == reflect.Slice && isStructType(rv.Type().Elem()):
+		rows := reflect.MakeSlice(rv.Type(), len(tb.Rows), len(tb.Rows))
+		for i := range tb.Rows {
+			elem := rows.Index(i)
+			if elem.Kind() == reflect.Ptr {
+				elem.Set(reflect.New(elem.Type().Elem()))
+				elem = elem.Elem()
+			}
+			err := tb.unmarshalRow(i, elem)
+			if err != nil {
+				return err
+			}
+		}
+		rv.Set(rows)
+		return nil
+	}
+	return ErrUnmarshalTarget
+}
+
+func isStructType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func (tb *CriUtfTable) unmarshalRow(row int, rv reflect.Value) error {
+	for _, column := range structColumns(rv.Type()) {
+		field, err := tb.Field(row, column.name)
+		if errors.Is(err, ErrColumnNotFound) && column.optional {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = setStructField(rv.Field(column.index), field)
+		if err != nil {
+			return fmt.Errorf("%w: %s.%s", err, tb.TableName, column.name)
+		}
+	}
+	return nil
+}
+
+func setStructField(dst reflect.Value, field CriField) error {
+	switch dst.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		v, err := field.Uint()
+		if err != nil {
+			return err
+		}
+		if dst.OverflowUint(v) {
+			return ErrValueOverflow
+		}
+		dst.SetUint(v)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		v, err := field.Int()
+		if err != nil {
+			return err
+		}
+		if dst.OverflowInt(v) {
+			return ErrValueOverflow
+		}
+		dst.SetInt(v)
+	case reflect.Bool:
+		v, err := field.Uint()
+		if err != nil {
+			return err
+		}
+		dst.SetBool(v != 0)
+	case reflect.Float32, reflect.Float64:
+		v, err := field.Float()
+		if err != nil {
+			return err
+		}
+		dst.SetFloat(v)
+	case reflect.String:
+		v, err := field.Text()
+		if err != nil {
+			return err
+		}
+		dst.SetString(v)
+	case reflect.Slice:
+		data, err := field.Bytes()
+		if err != nil {
+			return err
+		}
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes(data)
+			return nil
+		}
+		if !isStructType(dst.Type().Elem()) {
+			return ErrUnsupportedFieldType
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		return unmarshalNestedTable(data, dst.Addr().Interface())
+	case reflect.Struct, reflect.Ptr:
+		data, err := field.Bytes()
+		if err != nil {
+			return err
+		}
+		if !isStructType(dst.Type()) {
+			return ErrUnsupportedFieldType
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		if dst.Kind() == reflect.Ptr {
+			dst.Set(reflect.New(dst.Type().Elem()))
+			dst = dst.Elem()
+		}
+		return unmarshalNestedTable(data, dst.Addr().Interface())
+	default:
+		return ErrUnsupportedFieldType
+	}
+	return nil
+}
+
+func unmarshalNestedTable(data []byte, v interface{}) error {
+	table, err := NewCriUtfTable(bytes.NewReader(data), 0)
+	if err != nil {
+		return err
+	}
+	return table.Unmarshal(v)
+}
+
+// Marshal returns table named name of rows in v (slice of struct, or struct for one row)
+// all columns are per-row, column type is selected by struct field type and
+// struct or slice of struct field is written as nested @UTF table
+// int64/int are written to 8 byte column and must not be negative, float64 must be float32 value
+func Marshal(name string, v interface{}) (*CriUtfTable, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	var rows []reflect.Value
+	switch {
+	case rv.Kind() == reflect.Struct:
+		rows = []reflect.Value{rv}
+	case (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && isStructType(rv.Type().Elem()):
+		for i := 0; i < rv.Len(); i++ {
+			rows = append(rows, reflect.Indirect(rv.Index(i)))
+		}
+	default:
+		return nil, ErrUnmarshalTarget
+	}
+
+	rowType := rv.Type()
+	if rv.Kind() != reflect.Struct {
+		rowType = rowType.Elem()
+		if rowType.Kind() == reflect.Ptr {
+			rowType = rowType.Elem()
+		}
+	}
+	fields := structColumns(rowType)
+	columns := make([]CriUtfColumn, len(fields))
+	for i, field := range fields {
+		columnType, ok := structFieldColumnType(rowType.Field(field.index).Type)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedFieldType, field.name)
+		}
+		columns[i] = CriUtfColumn{Name: field.name, Type: columnType, Storage: ColumnStoragePerrow}
+	}
+
+	table, err := CreateCriUtfTable(name, columns)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		values := make(map[string]interface{}, len(fields))
+		for i, field := range fields {
+			if !row.IsValid() {
+				break
+			}
+			values[field.name], err = structFieldValue(field.name, columns[i].Type, row.Field(field.index))
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = table.AppendRow(values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+func structFieldColumnType(t reflect.Type) (byte, bool) {
+	switch t.Kind() {
+	case reflect.Uint8, reflect.Bool:
+		return ColumnType1Byte, true
+	case reflect.Int8:
+		return ColumnType1Byte2, true
+	case reflect.Uint16:
+		return ColumnType2Byte, true
+	case reflect.Int16:
+		return ColumnType2Byte2, true
+	case reflect.Uint32:
+		return ColumnType4Byte, true
+	case reflect.Int32:
+		return ColumnType4Byte2, true
+	case reflect.Uint64, reflect.Uint, reflect.Int64, reflect.Int:
+		// @UTF has no signed 8 byte column, negative value is rejected by structFieldValue
+		return ColumnType8Byte, true
+	case reflect.Float32, reflect.Float64:
+		return ColumnTypeFloat, true
+	case reflect.String:
+		return ColumnTypeString, true
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 || isStructType(t.Elem()) {
+			return ColumnTypeData, true
+		}
+	case reflect.Struct, reflect.Ptr:
+		if isStructType(t) {
+			return ColumnTypeData, true
+		}
+	}
+	return 0, false
+}
+
+func structFieldValue(name string, columnType byte, v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return byte(1), nil
+		}
+		return byte(0), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		if columnType == ColumnType8Byte && v.Int() < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrValueOverflow, name)
+		}
+		return columnValueFromUint(columnType, uint64(v.Int()))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return columnValueFromUint(columnType, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		// float column is 4 byte, float64 is written only when it is float32 value
+		f := float32(v.Float())
+		if float64(f) != v.Float() && !math.IsNaN(v.Float()) {
+			return nil, fmt.Errorf("%w: %s", ErrValueOverflow, name)
+		}
+		return f, nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte{}, v.Bytes()...), nil
+		}
+		if v.Len() == 0 {
+			return []byte{}, nil
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return []byte{}, nil
+		}
+	}
+	table, err := Marshal(name, v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return table.Bytes()
+}
@@ -0,0 +1,48 @@
+package acb
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+type structTestRow struct {
+	Int   int     `utf:"Int"`
+	Uint  uint    `utf:"Uint"`
+	Int64 int64   `utf:"Int64"`
+	Int16 int16   `utf:"Int16"`
+	Float float64 `utf:"Float"`
+}
+
+func TestMarshalUnmarshalSymmetric(t *testing.T) {
+	rows := []structTestRow{
+		{Int: 1, Uint: 2, Int64: math.MaxInt64, Int16: -3, Float: 0.5},
+		{Float: float64(float32(0.1))},
+	}
+	table, err := Marshal("Table", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []structTestRow
+	err = table.Unmarshal(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(rows) {
+		t.Fatalf("rows = %+v", got)
+	}
+	for i := range rows {
+		if got[i] != rows[i] {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], rows[i])
+		}
+	}
+}
+
+func TestMarshalRejectsLossyValues(t *testing.T) {
+	for _, row := range []structTestRow{{Int64: -1}, {Int: -1}, {Float: 0.1}} {
+		_, err := Marshal("Table", row)
+		if !errors.Is(err, ErrValueOverflow) {
+			t.Errorf("Marshal(%+v) err = %v, want ErrValueOverflow", row, err)
+		}
+	}
+}
@@ -28,11 +28,13 @@ type CriUtfTable struct {
 	NumberOfFields    uint16
 	RowSize           uint16
 	NumberOfRows      uint32
+	DataAlignment     uint32
 
 	buf        *endibuf.Reader
 	baseOffset int64
 
-	Rows []map[string]CriField
+	Columns []CriUtfColumn
+	Rows    []map[string]CriField
 }
 
 // CriField is column field data
@@ -104,9 +106,37 @@ func NewCriUtfTable(base io.ReadSeeker, offset int64) (table *CriUtfTable, err e
 	if err != nil {
 		return nil, err
 	}
+	table.DataAlignment = table.guessDataAlignment()
 	return
 }
 
+// guessDataAlignment returns alignment of data section for rewriting table
+func (tb *CriUtfTable) guessDataAlignment() uint32 {
+	offsets := []uint32{tb.DataOffset, tb.Size + 8}
+	for _, row := range tb.Rows {
+		for _, field := range row {
+			if field.Type&ColumnTypeMask == ColumnTypeData && field.Size > 0 {
+				offsets = append(offsets, field.Offset-uint32(tb.baseOffset))
+			}
+		}
+	}
+	alignment := uint32(0x20)
+	for alignment > 1 {
+		aligned := true
+		for _, offset := range offsets {
+			if offset%alignment != 0 {
+				aligned = false
+				break
+			}
+		}
+		if aligned {
+			break
+		}
+		alignment >>= 1
+	}
+	return alignment
+}
+
 func (tb *CriUtfTable) initializeHeader() (err error) {
 	tb.buf.Seek(8, 0)
 	tb.Unknown1, err = tb.buf.ReadUint16()
@@ -152,232 +182,207 @@ func (tb *CriUtfTable) initializeHeader() (err error) {
 	return
 }
 
+// column storage (high nibble of column flag)
 const (
-	columnStorageMask = 0xF0
+	ColumnStorageMask = 0xF0
 
-	columnStorageConstant  = 0x30
-	columnStorageConstant2 = 0x70
-	columnStoragePerrow    = 0x50
+	ColumnStorageZero      = 0x10
+	ColumnStorageConstant  = 0x30
+	ColumnStorageConstant2 = 0x70
+	ColumnStoragePerrow    = 0x50
 )
 
+// column type (low nibble of column flag)
 const (
-	columnTypeMask byte = 0x0F
-
-	columnTypeString = 0x0A
-	columnType8Byte  = 0x06
-	columnTypeData   = 0x0B
-	columnTypeFloat  = 0x08
-	columnType4Byte2 = 0x05
-	columnType4Byte  = 0x04
-	columnType2Byte2 = 0x03
-	columnType2Byte  = 0x02
-	columnType1Byte2 = 0x01
-	columnType1Byte  = 0x00
+	ColumnTypeMask byte = 0x0F
+
+	ColumnTypeString = 0x0A
+	ColumnType8Byte  = 0x06
+	ColumnTypeData   = 0x0B
+	ColumnTypeFloat  = 0x08
+	ColumnType4Byte2 = 0x05
+	ColumnType4Byte  = 0x04
+	ColumnType2Byte2 = 0x03
+	ColumnType2Byte  = 0x02
+	ColumnType1Byte2 = 0x01
+	ColumnType1Byte  = 0x00
 )
 
+// ErrUnknownColumnStorage is unknown column storage error
+var ErrUnknownColumnStorage = errors.New("unknown column storage")
+
+// CriUtfColumn is column schema. Constant holds value of constant column
+type CriUtfColumn struct {
+	Name     string
+	Type     byte
+	Storage  byte
+	Constant CriField
+}
+
+// Flag returns column flag byte (storage | type)
+func (c CriUtfColumn) Flag() byte {
+	return c.Storage | c.Type
+}
+
 func (tb *CriUtfTable) initializeSchema() (err error) {
-	var schemaOffset int64 = 0x20
 	var nameOffset uint32
-	var constantOffset int64
-	var currentOffset, currentRowBase, currentRowOffset int64
-	for i := uint32(0); i < tb.NumberOfRows; i++ {
-		tb.Rows[i] = make(map[string]CriField)
+	currentOffset := int64(0x20)
 
-		currentOffset = schemaOffset
-		currentRowBase = int64(uint32(tb.RowOffset) + (i * uint32(tb.RowSize)))
-		currentRowOffset = 0
+	tb.Columns = make([]CriUtfColumn, tb.NumberOfFields)
+	for j := range tb.Columns {
+		column := &tb.Columns[j]
+		var flag byte
+		flag, err = tb.buf.ReadByteFromOffset(currentOffset)
+		if err != nil {
+			return
+		}
+		column.Storage = flag & ColumnStorageMask
+		column.Type = flag & ColumnTypeMask
+		nameOffset, err = tb.buf.ReadUint32FromOffset(currentOffset + 1)
+		if err != nil {
+			return
+		}
+		column.Name, err = tb.buf.ReadCStringFromOffset(int64(tb.StringTableOffset + nameOffset))
+		if err != nil {
+			return
+		}
+		currentOffset += 5
 
-		for j := uint16(0); j < tb.NumberOfFields; j++ {
-			var field CriField
-			field.Type, err = tb.buf.ReadByteFromOffset(currentOffset)
-			if err != nil {
-				return
-			}
-			nameOffset, err = tb.buf.ReadUint32FromOffset(currentOffset + 1)
+		switch column.Storage {
+		case ColumnStorageConstant, ColumnStorageConstant2:
+			var size int64
+			column.Constant, size, err = tb.readField(flag, column.Name, currentOffset)
 			if err != nil {
 				return
 			}
-			field.Name, err = tb.buf.ReadCStringFromOffset(int64(tb.StringTableOffset + nameOffset))
-			if err != nil {
-				return
+			currentOffset += size
+		case ColumnStorageZero:
+			column.Constant = CriField{Type: flag, Name: column.Name, Value: zeroColumnValue(column.Type)}
+		case ColumnStoragePerrow:
+			if columnTypeSize(column.Type) == 0 {
+				return ErrUnknownColumnType
 			}
+		default:
+			return ErrUnknownColumnStorage
+		}
+	}
 
-			switch columnStorageMask & field.Type {
-			case columnStorageConstant, columnStorageConstant2:
-				constantOffset = currentOffset + 5
-
-				switch field.Type & columnTypeMask {
-				case columnTypeString:
-					dataOffset, err := tb.buf.ReadUint32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					field.Value, err = tb.buf.ReadCStringFromOffset(int64(tb.StringTableOffset + dataOffset))
-					if err != nil {
-						return err
-					}
-					currentOffset += 4
-				case columnType8Byte:
-					field.Value, err = tb.buf.ReadUint64FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentOffset += 8
-				case columnTypeData:
-					dataOffset, err := tb.buf.ReadUint32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					dataSize, err := tb.buf.ReadUint32FromOffset(constantOffset + 4)
-					if err != nil {
-						return err
-					}
-					field.Offset = tb.DataOffset + dataOffset
-					field.Size = dataSize
-					field.Value, err = tb.buf.ReadBytesFromOffset(int64(field.Offset), int(field.Size))
-					if err != nil {
-						return err
-					}
-					field.Offset += uint32(tb.baseOffset)
-					currentOffset += 8
-				case columnTypeFloat:
-					field.Value, err = tb.buf.ReadFloat32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentOffset += 4
-				case columnType4Byte2:
-					field.Value, err = tb.buf.ReadInt32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentOffset += 4
-				case columnType4Byte:
-					field.Value, err = tb.buf.ReadUint32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentOffset += 4
-				case columnType2Byte2:
-					field.Value, err = tb.buf.ReadInt16FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentOffset += 2
-				case columnType2Byte:
-					field.Value, err = tb.buf.ReadUint16FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentOffset += 2
-				case columnType1Byte2, columnType1Byte:
-					field.Value, err = tb.buf.ReadByteFromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentOffset++
-				default:
-					return ErrUnknownColumnType
-				}
-			case columnStoragePerrow:
-				constantOffset = currentRowBase + currentRowOffset
-
-				switch field.Type & columnTypeMask {
-				case columnTypeString:
-					dataOffset, err := tb.buf.ReadUint32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					field.Value, err = tb.buf.ReadCStringFromOffset(int64(tb.StringTableOffset + dataOffset))
-					if err != nil {
-						return err
-					}
-					currentRowOffset += 4
-				case columnType8Byte:
-					field.Value, err = tb.buf.ReadUint64FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentRowOffset += 8
-				case columnTypeData:
-					dataOffset, err := tb.buf.ReadUint32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					dataSize, err := tb.buf.ReadUint32FromOffset(constantOffset + 4)
-					if err != nil {
-						return err
-					}
-					field.Offset = tb.DataOffset + dataOffset
-					field.Size = dataSize
-					field.Value, err = tb.buf.ReadBytesFromOffset(int64(field.Offset), int(field.Size))
-					if err != nil {
-						return err
-					}
-					field.Offset += uint32(tb.baseOffset)
-					currentRowOffset += 8
-				case columnTypeFloat:
-					field.Value, err = tb.buf.ReadFloat32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentRowOffset += 4
-				case columnType4Byte2:
-					field.Value, err = tb.buf.ReadInt32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentRowOffset += 4
-				case columnType4Byte:
-					field.Value, err = tb.buf.ReadUint32FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentRowOffset += 4
-				case columnType2Byte2:
-					field.Value, err = tb.buf.ReadInt16FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentRowOffset += 2
-				case columnType2Byte:
-					field.Value, err = tb.buf.ReadUint16FromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentRowOffset += 2
-				case columnType1Byte2, columnType1Byte:
-					field.Value, err = tb.buf.ReadByteFromOffset(constantOffset)
-					if err != nil {
-						return err
-					}
-					currentRowOffset++
-				default:
-					return ErrUnknownColumnType
+	for i := uint32(0); i < tb.NumberOfRows; i++ {
+		tb.Rows[i] = make(map[string]CriField)
+
+		currentRowOffset := int64(uint32(tb.RowOffset) + (i * uint32(tb.RowSize)))
+		for _, column := range tb.Columns {
+			field := column.Constant
+			if column.Storage == ColumnStoragePerrow {
+				var size int64
+				field, size, err = tb.readField(column.Flag(), column.Name, currentRowOffset)
+				if err != nil {
+					return
 				}
+				currentRowOffset += size
 			}
+			tb.Rows[i][column.Name] = field
+		}
+	}
+	return nil
+}
+
+// columnTypeSize returns stored size of column type
+func columnTypeSize(columnType byte) int64 {
+	switch columnType {
+	case ColumnType8Byte, ColumnTypeData:
+		return 8
+	case ColumnTypeString, ColumnTypeFloat, ColumnType4Byte2, ColumnType4Byte:
+		return 4
+	case ColumnType2Byte2, ColumnType2Byte:
+		return 2
+	case ColumnType1Byte2, ColumnType1Byte:
+		return 1
+	}
+	return 0
+}
 
-			tb.Rows[i][field.Name] = field
+func zeroColumnValue(columnType byte) interface{} {
+	switch columnType {
+	case ColumnTypeString:
+		return ""
+	case ColumnType8Byte:
+		return uint64(0)
+	case ColumnTypeData:
+		return []byte{}
+	case ColumnTypeFloat:
+		return float32(0)
+	case ColumnType4Byte2:
+		return int32(0)
+	case ColumnType4Byte:
+		return uint32(0)
+	case ColumnType2Byte2:
+		return int16(0)
+	case ColumnType2Byte:
+		return uint16(0)
+	}
+	return byte(0)
+}
 
-			currentOffset += 5
+// readField reads value of column type at offset and returns field and stored size
+func (tb *CriUtfTable) readField(flag byte, name string, offset int64) (field CriField, size int64, err error) {
+	field.Type = flag
+	field.Name = name
+
+	columnType := flag & ColumnTypeMask
+	size = columnTypeSize(columnType)
+	switch columnType {
+	case ColumnTypeString:
+		var dataOffset uint32
+		dataOffset, err = tb.buf.ReadUint32FromOffset(offset)
+		if err != nil {
+			return
+		}
+		field.Value, err = tb.buf.ReadCStringFromOffset(int64(tb.StringTableOffset + dataOffset))
+	case ColumnType8Byte:
+		field.Value, err = tb.buf.ReadUint64FromOffset(offset)
+	case ColumnTypeData:
+		var dataOffset, dataSize uint32
+		dataOffset, err = tb.buf.ReadUint32FromOffset(offset)
+		if err != nil {
+			return
 		}
+		dataSize, err = tb.buf.ReadUint32FromOffset(offset + 4)
+		if err != nil {
+			return
+		}
+		field.Offset = tb.DataOffset + dataOffset
+		field.Size = dataSize
+		field.Value, err = tb.buf.ReadBytesFromOffset(int64(field.Offset), int(field.Size))
+		field.Offset += uint32(tb.baseOffset)
+	case ColumnTypeFloat:
+		field.Value, err = tb.buf.ReadFloat32FromOffset(offset)
+	case ColumnType4Byte2:
+		field.Value, err = tb.buf.ReadInt32FromOffset(offset)
+	case ColumnType4Byte:
+		field.Value, err = tb.buf.ReadUint32FromOffset(offset)
+	case ColumnType2Byte2:
+		field.Value, err = tb.buf.ReadInt16FromOffset(offset)
+	case ColumnType2Byte:
+		field.Value, err = tb.buf.ReadUint16FromOffset(offset)
+	case ColumnType1Byte2, ColumnType1Byte:
+		field.Value, err = tb.buf.ReadByteFromOffset(offset)
+	default:
+		err = ErrUnknownColumnType
 	}
-	return nil
+	return
 }
 
 func decryptUtfData(seed, inc byte, step int, data []byte) []byte {
+	// xor of byte n is seed * inc^n, data starts at byte step
 	curXor := seed
 	for i := 0; i < step; i++ {
-		if i > 0 {
-			curXor *= inc
-		}
+		curXor *= inc
 	}
 	res := make([]byte, len(data))
 	for i := range data {
-		if i > 0 {
-			curXor *= inc
-		}
 		res[i] = data[i] ^ curXor
+		curXor *= inc
 	}
 	return res
 }
@@ -0,0 +1,184 @@
+package acb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrColumnNotFound is missing column error
+var ErrColumnNotFound = errors.New("column not found")
+
+// ErrRowOutOfRange is row index out of table range error
+var ErrRowOutOfRange = errors.New("row index out of range")
+
+// ErrValueOverflow is value does not fit requested type error
+var ErrValueOverflow = errors.New("column value overflow")
+
+// Uint returns unsigned integer value, any integer width is widened
+func (f CriField) Uint() (uint64, error) {
+	switch v := f.Value.(type) {
+	case byte:
+		return uint64(v), nil
+	case uint16:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	case int16:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+		return 0, ErrValueOverflow
+	case int32:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+		return 0, ErrValueOverflow
+	}
+	return 0, ErrColumnValueType
+}
+
+// Int returns signed integer value, any integer width is widened
+func (f CriField) Int() (int64, error) {
+	switch v := f.Value.(type) {
+	case byte:
+		if f.Type&ColumnTypeMask == ColumnType1Byte2 {
+			return int64(int8(v)), nil
+		}
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, ErrValueOverflow
+		}
+		return int64(v), nil
+	}
+	u, err := f.Uint()
+	return int64(u), err
+}
+
+// Float returns float value
+func (f CriField) Float() (float64, error) {
+	if v, ok := f.Value.(float32); ok {
+		return float64(v), nil
+	}
+	return 0, ErrColumnValueType
+}
+
+// Text returns string value
+func (f CriField) Text() (string, error) {
+	if v, ok := f.Value.(string); ok {
+		return v, nil
+	}
+	return "", ErrColumnValueType
+}
+
+// Bytes returns data value
+func (f CriField) Bytes() ([]byte, error) {
+	if v, ok := f.Value.([]byte); ok {
+		return v, nil
+	}
+	return nil, ErrColumnValueType
+}
+
+// Field returns field of row, error wraps ErrColumnNotFound when table has no column
+func (tb *CriUtfTable) Field(row int, name string) (CriField, error) {
+	if row < 0 || row >= len(tb.Rows) {
+		return CriField{}, ErrRowOutOfRange
+	}
+	field, ok := tb.Rows[row][name]
+	if !ok {
+		return CriField{}, fmt.Errorf("%w: %s.%s", ErrColumnNotFound, tb.TableName, name)
+	}
+	return field, nil
+}
+
+// HasColumn reports whether table has column
+func (tb *CriUtfTable) HasColumn(name string) bool {
+	for _, column := range tb.Columns {
+		if column.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func columnError(tb *CriUtfTable, name string, err error) error {
+	if err == ErrColumnValueType || err == ErrValueOverflow {
+		return fmt.Errorf("%w: %s.%s", err, tb.TableName, name)
+	}
+	return err
+}
+
+// Uint returns unsigned integer value of column
+func (tb *CriUtfTable) Uint(row int, name string) (uint64, error) {
+	field, err := tb.Field(row, name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := field.Uint()
+	return v, columnError(tb, name, err)
+}
+
+// Int returns signed integer value of column
+func (tb *CriUtfTable) Int(row int, name string) (int64, error) {
+	field, err := tb.Field(row, name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := field.Int()
+	return v, columnError(tb, name, err)
+}
+
+// Float returns float value of column
+func (tb *CriUtfTable) Float(row int, name string) (float64, error) {
+	field, err := tb.Field(row, name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := field.Float()
+	return v, columnError(tb, name, err)
+}
+
+// String returns string value of column
+func (tb *CriUtfTable) String(row int, name string) (string, error) {
+	field, err := tb.Field(row, name)
+	if err != nil {
+		return "", err
+	}
+	v, err := field.Text()
+	return v, columnError(tb, name, err)
+}
+
+// Data returns data value of column, it is not Bytes because Bytes of table returns the table data
+func (tb *CriUtfTable) Data(row int, name string) ([]byte, error) {
+	field, err := tb.Field(row, name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := field.Bytes()
+	return v, columnError(tb, name, err)
+}
+
+// uintValue returns unsigned integer value of column which must be less than or equal to max
+func (tb *CriUtfTable) uintValue(row int, name string, max uint64) (uint64, error) {
+	v, err := tb.Uint(row, name)
+	if err == nil && v > max {
+		err = fmt.Errorf("%w: %s.%s", ErrValueOverflow, tb.TableName, name)
+	}
+	return v, err
+}
+
+// optionalData returns data value of column, missing column is nil
+func (tb *CriUtfTable) optionalData(row int, name string) ([]byte, error) {
+	v, err := tb.Data(row, name)
+	if errors.Is(err, ErrColumnNotFound) {
+		return nil, nil
+	}
+	return v, err
+}
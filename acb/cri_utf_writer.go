@@ -0,0 +1,391 @@
+package acb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// defaultDataAlignment is data section alignment of new table
+const defaultDataAlignment = 8
+
+// ErrUnknownColumn is not in schema column error
+var ErrUnknownColumn = errors.New("unknown column")
+
+// ErrColumnExists is adding column which is already in schema error
+var ErrColumnExists = errors.New("column already exists")
+
+// ErrColumnValueType is column value type mismatch error
+var ErrColumnValueType = errors.New("column value type mismatch")
+
+// CreateCriUtfTable returns empty table with name and column schema
+// constant columns must have Constant.Value of column type
+func CreateCriUtfTable(name string, columns []CriUtfColumn) (*CriUtfTable, error) {
+	tb := &CriUtfTable{
+		Signature:      SignatureCriUtfTable,
+		Unknown1:       1,
+		TableName:      name,
+		NumberOfFields: uint16(len(columns)),
+		DataAlignment:  defaultDataAlignment,
+		Columns:        make([]CriUtfColumn, len(columns)),
+	}
+	for i, column := range columns {
+		column, err := newColumn(column)
+		if err != nil {
+			return nil, err
+		}
+		tb.Columns[i] = column
+	}
+	return tb, nil
+}
+
+// newColumn returns column with constant value set for its storage
+func newColumn(column CriUtfColumn) (CriUtfColumn, error) {
+	if columnTypeSize(column.Type) == 0 {
+		return column, ErrUnknownColumnType
+	}
+	switch column.Storage {
+	case ColumnStorageConstant, ColumnStorageConstant2:
+		if !isColumnValue(column.Type, column.Constant.Value) {
+			return column, ErrColumnValueType
+		}
+	case ColumnStorageZero:
+		column.Constant.Value = zeroColumnValue(column.Type)
+	case ColumnStoragePerrow:
+		column.Constant = CriField{}
+	default:
+		return column, ErrUnknownColumnStorage
+	}
+	if column.Storage != ColumnStoragePerrow {
+		column.Constant.Type = column.Flag()
+		column.Constant.Name = column.Name
+	}
+	return column, nil
+}
+
+// AddColumn appends column to schema, per-row column of existing rows is zero value
+func (tb *CriUtfTable) AddColumn(column CriUtfColumn) error {
+	if tb.HasColumn(column.Name) {
+		return fmt.Errorf("%w: %s.%s", ErrColumnExists, tb.TableName, column.Name)
+	}
+	column, err := newColumn(column)
+	if err != nil {
+		return err
+	}
+	tb.Columns = append(tb.Columns, column)
+	tb.NumberOfFields = uint16(len(tb.Columns))
+	for _, row := range tb.Rows {
+		field := column.Constant
+		if column.Storage == ColumnStoragePerrow {
+			field = CriField{Type: column.Flag(), Name: column.Name, Value: zeroColumnValue(column.Type)}
+		}
+		row[column.Name] = field
+	}
+	return nil
+}
+
+// AppendRow appends row of per-row column values, missing column is zero value
+func (tb *CriUtfTable) AppendRow(values map[string]interface{}) error {
+	row := make(map[string]CriField, len(tb.Columns))
+	for _, column := range tb.Columns {
+		if column.Storage != ColumnStoragePerrow {
+			row[column.Name] = column.Constant
+			continue
+		}
+		value, ok := values[column.Name]
+		if !ok {
+			value = zeroColumnValue(column.Type)
+		}
+		if !isColumnValue(column.Type, value) {
+			return ErrColumnValueType
+		}
+		row[column.Name] = CriField{Type: column.Flag(), Name: column.Name, Value: value}
+	}
+	for name := range values {
+		if _, ok := row[name]; !ok {
+			return ErrUnknownColumn
+		}
+	}
+	tb.Rows = append(tb.Rows, row)
+	tb.NumberOfRows = uint32(len(tb.Rows))
+	return nil
+}
+
+func isColumnValue(columnType byte, value interface{}) (ok bool) {
+	switch columnType {
+	case ColumnTypeString:
+		_, ok = value.(string)
+	case ColumnType8Byte:
+		_, ok = value.(uint64)
+	case ColumnTypeData:
+		_, ok = value.([]byte)
+	case ColumnTypeFloat:
+		_, ok = value.(float32)
+	case ColumnType4Byte2:
+		_, ok = value.(int32)
+	case ColumnType4Byte:
+		_, ok = value.(uint32)
+	case ColumnType2Byte2:
+		_, ok = value.(int16)
+	case ColumnType2Byte:
+		_, ok = value.(uint16)
+	case ColumnType1Byte2, ColumnType1Byte:
+		_, ok = value.(byte)
+	}
+	return
+}
+
+// utfStringTable is deduplicated string table builder
+type utfStringTable struct {
+	data    []byte
+	offsets map[string]uint32
+}
+
+func newUtfStringTable() *utfStringTable {
+	st := &utfStringTable{offsets: make(map[string]uint32)}
+	st.add("<NULL>")
+	return st
+}
+
+func (st *utfStringTable) add(s string) uint32 {
+	if offset, ok := st.offsets[s]; ok {
+		return offset
+	}
+	offset := uint32(len(st.data))
+	st.data = append(st.data, s...)
+	st.data = append(st.data, 0)
+	st.offsets[s] = offset
+	return offset
+}
+
+// utfDataSection is data section builder, blobs are aligned
+type utfDataSection struct {
+	data      []byte
+	alignment int
+}
+
+func (ds *utfDataSection) add(b []byte) uint32 {
+	if len(b) == 0 {
+		return 0
+	}
+	ds.data = padBytes(ds.data, ds.alignment)
+	offset := uint32(len(ds.data))
+	ds.data = append(ds.data, b...)
+	return offset
+}
+
+func padBytes(b []byte, alignment int) []byte {
+	for alignment > 1 && len(b)%alignment != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// Bytes returns @UTF table data, encrypted by Seek and Increment if IsEncrypt
+func (tb *CriUtfTable) Bytes() ([]byte, error) {
+	alignment := int(tb.DataAlignment)
+	if alignment < 1 {
+		alignment = 1
+	}
+	strings := newUtfStringTable()
+	data := &utfDataSection{alignment: alignment}
+	tableNameOffset := strings.add(tb.TableName)
+
+	schema := []byte{}
+	rowSize := 0
+	for _, column := range tb.Columns {
+		if columnTypeSize(column.Type) == 0 {
+			return nil, ErrUnknownColumnType
+		}
+		schema = append(schema, column.Flag())
+		schema = appendUint32(schema, strings.add(column.Name))
+		switch column.Storage {
+		case ColumnStorageConstant, ColumnStorageConstant2:
+			var err error
+			schema, err = appendColumnValue(schema, column.Type, column.Constant.Value, strings, data)
+			if err != nil {
+				return nil, err
+			}
+		case ColumnStoragePerrow:
+			rowSize += int(columnTypeSize(column.Type))
+		case ColumnStorageZero:
+		default:
+			return nil, ErrUnknownColumnStorage
+		}
+	}
+
+	rows := make([]byte, 0, rowSize*len(tb.Rows))
+	for _, row := range tb.Rows {
+		for _, column := range tb.Columns {
+			if column.Storage != ColumnStoragePerrow {
+				continue
+			}
+			field, ok := row[column.Name]
+			value := field.Value
+			if !ok {
+				value = zeroColumnValue(column.Type)
+			}
+			var err error
+			rows, err = appendColumnValue(rows, column.Type, value, strings, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rowOffset := 0x20 + len(schema)
+	stringTableOffset := rowOffset + len(rows)
+	dataOffset := stringTableOffset + len(strings.data)
+	dataOffset += (alignment - dataOffset%alignment) % alignment
+	size := dataOffset + len(data.data)
+	size += (alignment - size%alignment) % alignment
+
+	res := make([]byte, 0x20, size)
+	copy(res, SignatureCriUtfTable)
+	binary.BigEndian.PutUint32(res[0x04:], uint32(size-8))
+	binary.BigEndian.PutUint16(res[0x08:], tb.Unknown1)
+	binary.BigEndian.PutUint16(res[0x0A:], uint16(rowOffset-8))
+	binary.BigEndian.PutUint32(res[0x0C:], uint32(stringTableOffset-8))
+	binary.BigEndian.PutUint32(res[0x10:], uint32(dataOffset-8))
+	binary.BigEndian.PutUint32(res[0x14:], tableNameOffset)
+	binary.BigEndian.PutUint16(res[0x18:], uint16(len(tb.Columns)))
+	binary.BigEndian.PutUint16(res[0x1A:], uint16(rowSize))
+	binary.BigEndian.PutUint32(res[0x1C:], uint32(len(tb.Rows)))
+	res = append(res, schema...)
+	res = append(res, rows...)
+	res = append(res, strings.data...)
+	res = padBytes(res, alignment)
+	res = append(res, data.data...)
+	res = padBytes(res, alignment)
+
+	if tb.IsEncrypt {
+		res = decryptUtfData(tb.Seek, tb.Increment, 0, res)
+	}
+	return res, nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendColumnValue(b []byte, columnType byte, value interface{}, strings *utfStringTable, data *utfDataSection) ([]byte, error) {
+	if !isColumnValue(columnType, value) {
+		return nil, ErrColumnValueType
+	}
+	switch columnType {
+	case ColumnTypeString:
+		b = appendUint32(b, strings.add(value.(string)))
+	case ColumnType8Byte:
+		v := value.(uint64)
+		b = appendUint32(b, uint32(v>>32))
+		b = appendUint32(b, uint32(v))
+	case ColumnTypeData:
+		blob := value.([]byte)
+		b = appendUint32(b, data.add(blob))
+		b = appendUint32(b, uint32(len(blob)))
+	case ColumnTypeFloat:
+		b = appendUint32(b, math.Float32bits(value.(float32)))
+	case ColumnType4Byte2:
+		b = appendUint32(b, uint32(value.(int32)))
+	case ColumnType4Byte:
+		b = appendUint32(b, value.(uint32))
+	case ColumnType2Byte2:
+		v := value.(int16)
+		b = append(b, byte(v>>8), byte(v))
+	case ColumnType2Byte:
+		v := value.(uint16)
+		b = append(b, byte(v>>8), byte(v))
+	case ColumnType1Byte2, ColumnType1Byte:
+		b = append(b, value.(byte))
+	}
+	return b, nil
+}
+
+// SetValue sets column value of row
+// constant column is changed to per-row column when value differs from constant
+func (tb *CriUtfTable) SetValue(row int, name string, value interface{}) error {
+	if row < 0 || row >= len(tb.Rows) {
+		return ErrRowOutOfRange
+	}
+	for i := range tb.Columns {
+		column := &tb.Columns[i]
+		if column.Name != name {
+			continue
+		}
+		if !isColumnValue(column.Type, value) {
+			return ErrColumnValueType
+		}
+		if column.Storage != ColumnStoragePerrow && !reflect.DeepEqual(column.Constant.Value, value) {
+			column.Storage = ColumnStoragePerrow
+			column.Constant = CriField{}
+			for _, r := range tb.Rows {
+				field := r[name]
+				field.Type = column.Flag()
+				r[name] = field
+			}
+		}
+		field := tb.Rows[row][name]
+		field.Value = value
+		if blob, ok := value.([]byte); ok {
+			field.Size = uint32(len(blob))
+		}
+		tb.Rows[row][name] = field
+		if column.Storage != ColumnStoragePerrow {
+			column.Constant = field
+		}
+		return nil
+	}
+	return ErrUnknownColumn
+}
+
+// SetUint sets integer column value of row, v must fit in column type
+func (tb *CriUtfTable) SetUint(row int, name string, v uint64) error {
+	value, err := tb.fitUint(name, v)
+	if err != nil {
+		return err
+	}
+	return tb.SetValue(row, name, value)
+}
+
+// fitUint returns v converted to type of integer column name, error when v does not fit
+func (tb *CriUtfTable) fitUint(name string, v uint64) (interface{}, error) {
+	for _, column := range tb.Columns {
+		if column.Name != name {
+			continue
+		}
+		bits := columnTypeSize(column.Type) * 8
+		switch column.Type {
+		case ColumnType4Byte2, ColumnType2Byte2, ColumnType1Byte2:
+			bits--
+		case ColumnType4Byte, ColumnType2Byte, ColumnType1Byte, ColumnType8Byte:
+		default:
+			return nil, fmt.Errorf("%w: %s.%s", ErrColumnValueType, tb.TableName, name)
+		}
+		if bits < 64 && v >= 1<<bits {
+			return nil, fmt.Errorf("%w: %s.%s", ErrValueOverflow, tb.TableName, name)
+		}
+		return columnValueFromUint(column.Type, v)
+	}
+	return nil, fmt.Errorf("%w: %s.%s", ErrUnknownColumn, tb.TableName, name)
+}
+
+// columnValueFromUint returns v converted to integer column type
+func columnValueFromUint(columnType byte, v uint64) (interface{}, error) {
+	switch columnType {
+	case ColumnType8Byte:
+		return v, nil
+	case ColumnType4Byte2:
+		return int32(v), nil
+	case ColumnType4Byte:
+		return uint32(v), nil
+	case ColumnType2Byte2:
+		return int16(v), nil
+	case ColumnType2Byte:
+		return uint16(v), nil
+	case ColumnType1Byte2, ColumnType1Byte:
+		return byte(v), nil
+	}
+	return nil, ErrColumnValueType
+}
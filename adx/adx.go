@@ -0,0 +1,117 @@
+// Package adx is CRI ADX audio header parser and decoder
+package adx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// encoding types
+const (
+	EncodingFixed    = 2
+	EncodingStandard = 3
+	EncodingExponent = 4
+)
+
+// ErrNotAdx is not adx data error
+var ErrNotAdx = errors.New("not adx data")
+
+// ErrInvalidHeader is broken or unsupported adx header error
+var ErrInvalidHeader = errors.New("invalid adx header")
+
+var copyrightSignature = []byte("(c)CRI")
+
+// Header is adx header
+type Header struct {
+	DataOffset     int
+	EncodingType   byte
+	FrameSize      int
+	BitsPerSample  int
+	Channels       int
+	SampleRate     int
+	TotalSamples   int
+	HighpassCutoff uint16
+	Version        byte
+	Flags          byte
+
+	LoopFlag        bool
+	LoopStartSample int
+	LoopStartOffset int
+	LoopEndSample   int
+	LoopEndOffset   int
+}
+
+// IsAdx reports whether data starts with adx signature
+func IsAdx(data []byte) bool {
+	if len(data) < 4 || data[0] != 0x80 || data[1] != 0x00 {
+		return false
+	}
+	offset := int(binary.BigEndian.Uint16(data[2:]))
+	if offset < 6 || len(data) < offset+4 {
+		return false
+	}
+	return bytes.Equal(data[offset-2:offset+4], copyrightSignature)
+}
+
+// HeaderSize returns header size (= data offset) from first 4 bytes of adx data
+func HeaderSize(data []byte) (int, error) {
+	if len(data) < 4 || data[0] != 0x80 || data[1] != 0x00 {
+		return 0, ErrNotAdx
+	}
+	return int(binary.BigEndian.Uint16(data[2:])) + 4, nil
+}
+
+// ParseHeader is parse adx header in data
+func ParseHeader(data []byte) (*Header, error) {
+	if !IsAdx(data) {
+		return nil, ErrNotAdx
+	}
+	h := &Header{}
+	h.DataOffset, _ = HeaderSize(data)
+	if h.DataOffset < 0x14 {
+		return nil, ErrInvalidHeader
+	}
+	h.EncodingType = data[0x04]
+	h.FrameSize = int(data[0x05])
+	h.BitsPerSample = int(data[0x06])
+	h.Channels = int(data[0x07])
+	h.SampleRate = int(binary.BigEndian.Uint32(data[0x08:]))
+	h.TotalSamples = int(binary.BigEndian.Uint32(data[0x0C:]))
+	h.HighpassCutoff = binary.BigEndian.Uint16(data[0x10:])
+	h.Version = data[0x12]
+	h.Flags = data[0x13]
+
+	// loop table follows base header (and v4 history), v5 has no loop
+	loopOffset := 0
+	switch h.Version {
+	case 3:
+		loopOffset = 0x14
+	case 4:
+		// history is 4 bytes per channel, mono and stereo keep 8 bytes
+		histSize := 4 * h.Channels
+		if histSize < 8 {
+			histSize = 8
+		}
+		loopOffset = 0x18 + histSize
+	}
+	// loop table is 0x18 bytes and must end before copyright
+	if loopOffset > 0 && loopOffset+0x18 <= h.DataOffset-6 {
+		loop := data[loopOffset:]
+		h.LoopFlag = binary.BigEndian.Uint32(loop[0x04:]) != 0
+		h.LoopStartSample = int(binary.BigEndian.Uint32(loop[0x08:]))
+		h.LoopStartOffset = int(binary.BigEndian.Uint32(loop[0x0C:]))
+		h.LoopEndSample = int(binary.BigEndian.Uint32(loop[0x10:]))
+		h.LoopEndOffset = int(binary.BigEndian.Uint32(loop[0x14:]))
+	}
+
+	if h.Channels < 1 || h.SampleRate < 1 || h.BitsPerSample != 4 || h.FrameSize < 3 {
+		return nil, ErrInvalidHeader
+	}
+	return h, nil
+}
+
+// SamplesPerFrame returns samples in one channel frame
+func (h *Header) SamplesPerFrame() int {
+	return (h.FrameSize - 2) * 8 / h.BitsPerSample
+}
@@ -0,0 +1,82 @@
+package adx
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// buildHeader returns adx header of version with loop table at loopOffset
+func buildHeader(version byte, channels int, loopOffset int) []byte {
+	dataOffset := 0x40
+	data := make([]byte, dataOffset)
+	data[0] = 0x80
+	binary.BigEndian.PutUint16(data[2:], uint16(dataOffset-4))
+	data[0x04] = EncodingStandard
+	data[0x05] = 18
+	data[0x06] = 4
+	data[0x07] = byte(channels)
+	binary.BigEndian.PutUint32(data[0x08:], 44100)
+	binary.BigEndian.PutUint32(data[0x0C:], 100000)
+	binary.BigEndian.PutUint16(data[0x10:], 500)
+	data[0x12] = version
+
+	// history bytes before loop table must not be read as loop
+	for i := 0x14; i < loopOffset; i++ {
+		data[i] = 0xEE
+	}
+	loop := data[loopOffset:]
+	binary.BigEndian.PutUint32(loop[0x04:], 1)
+	binary.BigEndian.PutUint32(loop[0x08:], 1000)
+	binary.BigEndian.PutUint32(loop[0x0C:], 0x400)
+	binary.BigEndian.PutUint32(loop[0x10:], 90000)
+	binary.BigEndian.PutUint32(loop[0x14:], 0x9000)
+	copy(data[dataOffset-6:], copyrightSignature)
+	return data
+}
+
+func TestParseHeaderLoop(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    byte
+		channels   int
+		loopOffset int
+	}{
+		{"v3 stereo", 3, 2, 0x14},
+		{"v4 mono", 4, 1, 0x20},
+		{"v4 stereo", 4, 2, 0x20},
+	}
+	for _, tt := range tests {
+		h, err := ParseHeader(buildHeader(tt.version, tt.channels, tt.loopOffset))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if h.DataOffset != 0x40 || h.Channels != tt.channels || h.SampleRate != 44100 || h.TotalSamples != 100000 {
+			t.Errorf("%s: header %+v", tt.name, h)
+		}
+		if !h.LoopFlag || h.LoopStartSample != 1000 || h.LoopStartOffset != 0x400 || h.LoopEndSample != 90000 || h.LoopEndOffset != 0x9000 {
+			t.Errorf("%s: loop %+v", tt.name, h)
+		}
+	}
+}
+
+func TestParseHeaderNoLoopSpace(t *testing.T) {
+	// v4 loop table must fit before copyright, after history
+	data := buildHeader(4, 2, 0x20)
+	data = data[:0x38]
+	binary.BigEndian.PutUint16(data[2:], 0x38-4)
+	copy(data[0x38-6:], copyrightSignature)
+	h, err := ParseHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.LoopFlag {
+		t.Errorf("loop read from short header: %+v", h)
+	}
+}
+
+func TestParseHeaderNotAdx(t *testing.T) {
+	_, err := ParseHeader([]byte("RIFF0000WAVE"))
+	if err != ErrNotAdx {
+		t.Errorf("err = %v, want ErrNotAdx", err)
+	}
+}
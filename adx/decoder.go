@@ -0,0 +1,222 @@
+package adx
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"github.com/vazrupe/go-acb/wav"
+)
+
+// ErrUnsupported is unsupported adx feature error
+var ErrUnsupported = errors.New("unsupported adx stream")
+
+// fixedCoefficients is encoding type 2 coefficient pairs, selected by frame
+var fixedCoefficients = [4][2]int32{
+	{0x0000, 0x0000},
+	{0x0F00, 0x0000},
+	{0x1CC0, -0x0D00},
+	{0x1880, -0x0DC0},
+}
+
+// Decoder is adx frame decoder
+type Decoder struct {
+	Header
+
+	r       io.Reader
+	frame   []byte
+	coef    [2]int32
+	history [][2]int32
+	decoded int
+
+	encrypted bool
+	key       Key
+	xor       uint16
+}
+
+// NewDecoder reads adx header from r and returns decoder for unencrypted stream
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	return NewDecoderWithKey(r, Key{})
+}
+
+// NewDecoderWithKey reads adx header from r and returns decoder using key
+func NewDecoderWithKey(r io.Reader, key Key) (*Decoder, error) {
+	head := make([]byte, 4)
+	_, err := io.ReadFull(r, head)
+	if err != nil {
+		return nil, err
+	}
+	size, err := HeaderSize(head)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	copy(data, head)
+	_, err = io.ReadFull(r, data[4:])
+	if err != nil {
+		return nil, err
+	}
+	header, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	switch header.EncodingType {
+	case EncodingFixed, EncodingStandard, EncodingExponent:
+	default:
+		return nil, ErrUnsupported
+	}
+	encrypted := false
+	switch header.Flags {
+	case 0:
+	case EncryptionKey8, EncryptionKey9:
+		if key == (Key{}) {
+			return nil, ErrKeyRequired
+		}
+		encrypted = true
+	default:
+		return nil, ErrUnsupported
+	}
+
+	d := &Decoder{
+		Header:  *header,
+		r:       r,
+		frame:   make([]byte, header.FrameSize),
+		history: make([][2]int32, header.Channels),
+
+		encrypted: encrypted,
+		key:       key,
+		xor:       key.Start,
+	}
+	d.coef = standardCoefficients(int(header.HighpassCutoff), header.SampleRate)
+	return d, nil
+}
+
+func standardCoefficients(cutoff, sampleRate int) [2]int32 {
+	z := math.Cos(2 * math.Pi * float64(cutoff) / float64(sampleRate))
+	a := math.Sqrt2 - z
+	b := math.Sqrt2 - 1
+	c := (a - math.Sqrt((a+b)*(a-b))) / b
+	// truncated toward zero like the reference decoder
+	return [2]int32{int32(c * 8192), int32(-(c * c) * 4096)}
+}
+
+// DecodeFrame decodes next frame of every channel and returns interleaved samples
+// returns io.EOF after last frame or end mark
+func (d *Decoder) DecodeFrame() ([]int16, error) {
+	if d.decoded >= d.TotalSamples {
+		return nil, io.EOF
+	}
+	samplesPerFrame := d.SamplesPerFrame()
+	count := samplesPerFrame
+	if d.TotalSamples-d.decoded < count {
+		count = d.TotalSamples - d.decoded
+	}
+
+	samples := make([]int16, count*d.Channels)
+	for ch := 0; ch < d.Channels; ch++ {
+		_, err := io.ReadFull(d.r, d.frame)
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		if d.frame[0]&0x80 != 0 && d.EncodingType != EncodingFixed {
+			// end mark (fixed type uses top bits as coefficient index)
+			return nil, io.EOF
+		}
+		d.decodeChannelFrame(ch, samples[ch:], count)
+	}
+	d.decoded += count
+	return samples, nil
+}
+
+func (d *Decoder) decodeChannelFrame(ch int, out []int16, count int) {
+	scale := int32(d.frame[0])<<8 | int32(d.frame[1])
+	coef := d.coef
+	switch {
+	case d.encrypted:
+		// key advances every frame in file order
+		scale = (scale^int32(d.xor))&0x1FFF + 1
+		d.xor = (d.xor*d.key.Mult + d.key.Add) & 0x7FFF
+	case d.EncodingType == EncodingStandard:
+		scale++
+	case d.EncodingType == EncodingExponent:
+		shift := 12 - scale
+		if shift < 0 {
+			shift = 0
+		}
+		scale = 1 << uint(shift)
+	case d.EncodingType == EncodingFixed:
+		coef = fixedCoefficients[(d.frame[0]>>5)&3]
+		scale = scale&0x1FFF + 1
+	}
+
+	hist1, hist2 := d.history[ch][0], d.history[ch][1]
+	for i := 0; i < count; i++ {
+		b := d.frame[2+i/2]
+		nibble := int32(b >> 4)
+		if i&1 != 0 {
+			nibble = int32(b & 0x0F)
+		}
+		if nibble >= 8 {
+			nibble -= 16
+		}
+		sample := nibble*scale + (coef[0]*hist1+coef[1]*hist2)>>12
+		if sample > math.MaxInt16 {
+			sample = math.MaxInt16
+		} else if sample < math.MinInt16 {
+			sample = math.MinInt16
+		}
+		out[i*d.Channels] = int16(sample)
+		hist2 = hist1
+		hist1 = sample
+	}
+	d.history[ch] = [2]int32{hist1, hist2}
+}
+
+// DecodeAll decodes all frames and returns interleaved samples
+func (d *Decoder) DecodeAll() ([]int16, error) {
+	samples := make([]int16, 0, d.TotalSamples*d.Channels)
+	for {
+		frame, err := d.DecodeFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, frame...)
+	}
+	return samples, nil
+}
+
+// DecodeWave decodes whole adx stream in r to *wav.Wave with loop
+func DecodeWave(r io.Reader, format wav.SampleFormat) (*wav.Wave, error) {
+	return DecodeWaveWithKey(r, Key{}, format)
+}
+
+// DecodeWaveWithKey decodes whole encrypted adx stream in r to *wav.Wave with loop
+func DecodeWaveWithKey(r io.Reader, key Key, format wav.SampleFormat) (*wav.Wave, error) {
+	d, err := NewDecoderWithKey(r, key)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := d.DecodeAll()
+	if err != nil {
+		return nil, err
+	}
+	wave := &wav.Wave{
+		Channels:   d.Channels,
+		SampleRate: d.SampleRate,
+		Format:     format,
+		Samples:    make([]float32, len(samples)),
+	}
+	for i, s := range samples {
+		wave.Samples[i] = float32(s) / 32768
+	}
+	if d.LoopFlag {
+		wave.Loop = &wav.Loop{Start: d.LoopStartSample, End: d.LoopEndSample}
+	}
+	return wave, nil
+}
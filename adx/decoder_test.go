@@ -0,0 +1,10 @@
+package adx
+
+import "testing"
+
+func TestStandardCoefficients(t *testing.T) {
+	coef := standardCoefficients(500, 44100)
+	if coef != [2]int32{7334, -3283} {
+		t.Errorf("coefficients of 500 Hz / 44100 Hz = %v, want [7334 -3283]", coef)
+	}
+}
@@ -0,0 +1,118 @@
+package adx
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// encryption flags
+const (
+	EncryptionKey8 = 0x08
+	EncryptionKey9 = 0x09
+)
+
+// ErrKeyRequired is encrypted adx without key error
+var ErrKeyRequired = errors.New("adx is encrypted, key required")
+
+// ErrInvalidKey is unparsable key error
+var ErrInvalidKey = errors.New("invalid adx key")
+
+// Key is adx xor key (start, mult, add)
+type Key struct {
+	Start uint16
+	Mult  uint16
+	Add   uint16
+}
+
+// key8Primes is first 1024 primes from 0x4000
+var key8Primes [0x400]int
+
+func init() {
+	n := 0x4000
+	for i := range key8Primes {
+		for !isPrime(n) {
+			n++
+		}
+		key8Primes[i] = n
+		n++
+	}
+}
+
+func isPrime(n int) bool {
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return n > 1
+}
+
+// KeyFromString derives type 8 key from key string
+func KeyFromString(keyString string) Key {
+	if keyString == "" {
+		return Key{}
+	}
+	start := key8Primes[0x100]
+	mult := key8Primes[0x200]
+	add := key8Primes[0x300]
+	for i := 0; i < len(keyString); i++ {
+		c := key8Primes[int(int8(keyString[i]))+0x80]
+		start = key8Primes[start*c%0x400]
+		mult = key8Primes[mult*c%0x400]
+		add = key8Primes[add*c%0x400]
+	}
+	return Key{Start: uint16(start), Mult: uint16(mult), Add: uint16(add)}
+}
+
+// KeyFromKeycode derives type 9 key from 64bit keycode and awb subkey
+func KeyFromKeycode(keycode uint64, subkey uint16) Key {
+	if keycode == 0 {
+		return Key{}
+	}
+	if subkey != 0 {
+		keycode *= uint64(subkey)<<16 | uint64(uint16(^subkey)+2)
+	}
+	keycode--
+	return Key{
+		Start: uint16(keycode>>27) & 0x7FFF,
+		Mult:  uint16(keycode>>12)&0x7FFC | 1,
+		Add:   uint16(keycode<<1)&0x7FFE | 1,
+	}
+}
+
+// ParseKey returns key for encryption type from s
+// s is "start,mult,add" triplet, keycode for type 9 or key string for type 8
+func ParseKey(s string, encryption byte, subkey uint16) (Key, error) {
+	if key, ok := parseKeyTriplet(s); ok {
+		return key, nil
+	}
+	switch encryption {
+	case EncryptionKey8:
+		return KeyFromString(s), nil
+	case EncryptionKey9:
+		keycode, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return Key{}, ErrInvalidKey
+		}
+		return KeyFromKeycode(keycode, subkey), nil
+	}
+	return Key{}, ErrInvalidKey
+}
+
+// parseKeyTriplet returns key of "start,mult,add", false unless all three parts are numbers
+func parseKeyTriplet(s string) (Key, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return Key{}, false
+	}
+	var values [3]uint16
+	for i, part := range parts {
+		v, err := strconv.ParseUint(strings.TrimSpace(part), 0, 16)
+		if err != nil {
+			return Key{}, false
+		}
+		values[i] = uint16(v)
+	}
+	return Key{Start: values[0], Mult: values[1], Add: values[2]}, true
+}
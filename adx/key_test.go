@@ -0,0 +1,26 @@
+package adx
+
+import "testing"
+
+func TestParseKey(t *testing.T) {
+	for _, c := range []struct {
+		s          string
+		encryption byte
+		want       Key
+	}{
+		{"0x49e1, 0x4a57, 0x553d", EncryptionKey8, Key{Start: 0x49e1, Mult: 0x4a57, Add: 0x553d}},
+		{"1,2,3", EncryptionKey9, Key{Start: 1, Mult: 2, Add: 3}},
+		{"key,with,commas", EncryptionKey8, KeyFromString("key,with,commas")},
+		{"12345", EncryptionKey9, KeyFromKeycode(12345, 0)},
+	} {
+		key, err := ParseKey(c.s, c.encryption, 0)
+		if err != nil || key != c.want {
+			t.Errorf("ParseKey(%q, %d) = %+v, %v, want %+v", c.s, c.encryption, key, err, c.want)
+		}
+	}
+
+	_, err := ParseKey("1,2,x", EncryptionKey9, 0)
+	if err != ErrInvalidKey {
+		t.Errorf("ParseKey of type 9 non-number err = %v, want ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vazrupe/go-acb/acb"
+)
+
+func runUtf2JSON(args []string) {
+	runConvert("utf2json", args, acb.UtfToJSON, func(name string) string {
+		return name + ".json"
+	})
+}
+
+func runJSON2Utf(args []string) {
+	runConvert("json2utf", args, acb.JSONToUtf, func(name string) string {
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	})
+}
+
+// runConvert converts each file by convert and writes to output name
+func runConvert(command string, args []string, convert func([]byte) ([]byte, error), outputName func(string) string) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = usage(flags, command+" [-o=OUTPUT] FILEs...")
+	output := flags.String("o", "", "output file (only with one input file)")
+	force := flags.Bool("f", false, "overwrite existing output file")
+	flags.Parse(args)
+
+	files := flags.Args()
+	if *output != "" && len(files) != 1 {
+		fmt.Fprintf(os.Stderr, "Error: -o needs exactly one input file\n")
+		os.Exit(2)
+	}
+	for _, filename := range files {
+		outName := *output
+		if outName == "" {
+			outName = outputName(filename)
+		}
+		if _, err := os.Stat(outName); err == nil && !*force {
+			fmt.Printf("Exists: `%s`. skip\n", outName)
+			continue
+		}
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Printf("Error: %s Open Failed (%s)\n", filename, err)
+			continue
+		}
+		converted, err := convert(data)
+		if errors.Is(err, acb.ErrNotIdentical) && converted != nil {
+			fmt.Printf("Warning: %s (%s, converting back will not give the same bytes)\n", filename, err)
+			err = nil
+		}
+		if err != nil {
+			fmt.Printf("Error: %s Convert Failed (%s)\n", filename, err)
+			continue
+		}
+		err = os.WriteFile(outName, converted, 0644)
+		if err != nil {
+			fmt.Printf("Error: %s Write Failed (%s)\n", outName, err)
+			continue
+		}
+		fmt.Printf("Convert: %s -> %s\n", filename, outName)
+	}
+}
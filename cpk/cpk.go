@@ -0,0 +1,313 @@
+// Package cpk is CRI CPK archive reader
+package cpk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/vazrupe/go-acb/acb"
+	"github.com/vazrupe/go-acb/crilayla"
+)
+
+// chunk signatures, each chunk is 0x10 bytes header and @UTF table
+var (
+	signatureCpk  = []byte("CPK ")
+	signatureToc  = []byte("TOC ")
+	signatureItoc = []byte("ITOC")
+	signatureEtoc = []byte("ETOC")
+)
+
+// chunkHeaderSize is signature, flag and 8 bytes table size
+const chunkHeaderSize = 0x10
+
+// ErrNotCpk is not cpk data error
+var ErrNotCpk = errors.New("not cpk data")
+
+// ErrInvalidChunk is broken toc/itoc chunk error
+var ErrInvalidChunk = errors.New("invalid cpk chunk")
+
+// ErrUnknownCompression is compressed file which is not crilayla error
+var ErrUnknownCompression = errors.New("unknown cpk file compression")
+
+// ErrExtractSize is decompressed size mismatch error
+var ErrExtractSize = errors.New("decompressed size differs from extract size")
+
+// Archive is CPK archive
+type Archive struct {
+	Header *acb.CriUtfTable
+
+	ContentOffset int64
+	TocOffset     int64
+	ItocOffset    int64
+	EtocOffset    int64
+	Align         int64
+
+	Files []File
+
+	r      io.ReaderAt
+	size   int64
+	closer io.Closer
+	toc    *acb.CriUtfTable
+	itoc   *acb.CriUtfTable
+	paths  map[string]int
+	dirs   map[string][]string
+}
+
+// File is file entry in archive
+type File struct {
+	DirName     string
+	FileName    string
+	ID          uint32
+	Offset      int64
+	FileSize    int64
+	ExtractSize int64
+	UserString  string
+}
+
+// Path returns slash separated path in archive, file without name is "ID.bin"
+func (f File) Path() string {
+	name := f.FileName
+	if name == "" {
+		name = fmt.Sprintf("%05d.bin", f.ID)
+	}
+	dir := strings.Trim(strings.ReplaceAll(f.DirName, "\\", "/"), "/")
+	return path.Join(dir, strings.ReplaceAll(name, "\\", "/"))
+}
+
+// IsCompressed reports whether file data is compressed (packed size differs)
+func (f File) IsCompressed() bool {
+	return f.ExtractSize != 0 && f.FileSize != f.ExtractSize
+}
+
+// OpenFile opens cpk file, archive must be closed by Close
+func OpenFile(name string) (*Archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a, err := Open(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a.closer = f
+	return a, nil
+}
+
+// Open reads cpk header and file table from r
+func Open(r io.ReaderAt, size int64) (*Archive, error) {
+	a := &Archive{r: r, size: size}
+	var err error
+	a.Header, err = readChunk(r, size, 0, signatureCpk)
+	if err == ErrInvalidChunk {
+		return nil, ErrNotCpk
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.Header.NumberOfRows == 0 {
+		return nil, ErrNotCpk
+	}
+
+	a.ContentOffset = headerValue(a.Header, "ContentOffset")
+	a.TocOffset = headerValue(a.Header, "TocOffset")
+	a.ItocOffset = headerValue(a.Header, "ItocOffset")
+	a.EtocOffset = headerValue(a.Header, "EtocOffset")
+	a.Align = headerValue(a.Header, "Align")
+	if a.Align < 1 {
+		a.Align = 1
+	}
+
+	if a.TocOffset > 0 {
+		err = a.readToc(size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if a.ItocOffset > 0 {
+		err = a.readItoc(size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	a.buildTree()
+	return a, nil
+}
+
+// Close closes file opened by OpenFile
+func (a *Archive) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+func headerValue(tb *acb.CriUtfTable, name string) int64 {
+	v, err := tb.Uint(0, name)
+	if err != nil {
+		return 0
+	}
+	return int64(v)
+}
+
+// readChunk reads @UTF table of chunk with signature at offset
+func readChunk(r io.ReaderAt, size, offset int64, signature []byte) (*acb.CriUtfTable, error) {
+	head := make([]byte, chunkHeaderSize)
+	_, err := r.ReadAt(head, offset)
+	if err != nil {
+		return nil, ErrInvalidChunk
+	}
+	if !bytes.Equal(head[:4], signature) {
+		return nil, ErrInvalidChunk
+	}
+	return acb.NewCriUtfTable(io.NewSectionReader(r, 0, size), offset+chunkHeaderSize)
+}
+
+func (a *Archive) readToc(size int64) error {
+	toc, err := readChunk(a.r, size, a.TocOffset, signatureToc)
+	if err != nil {
+		return err
+	}
+	a.toc = toc
+	// toc file offset is relative to the smaller of content and toc offset
+	base := a.TocOffset
+	if a.ContentOffset > 0 && a.ContentOffset < base {
+		base = a.ContentOffset
+	}
+
+	a.Files = make([]File, toc.NumberOfRows)
+	for i := range a.Files {
+		f := &a.Files[i]
+		f.DirName, _ = toc.String(i, "DirName")
+		f.FileName, err = toc.String(i, "FileName")
+		if err != nil {
+			return err
+		}
+		fileSize, err := toc.Uint(i, "FileSize")
+		if err != nil {
+			return err
+		}
+		extractSize, err := toc.Uint(i, "ExtractSize")
+		if err != nil {
+			extractSize = fileSize
+		}
+		fileOffset, err := toc.Uint(i, "FileOffset")
+		if err != nil {
+			return err
+		}
+		id, _ := toc.Uint(i, "ID")
+		f.UserString, _ = toc.String(i, "UserString")
+
+		f.ID = uint32(id)
+		f.FileSize = int64(fileSize)
+		f.ExtractSize = int64(extractSize)
+		f.Offset = base + int64(fileOffset)
+	}
+	return nil
+}
+
+// readItoc reads id table, without toc files are placed in id order from content offset
+func (a *Archive) readItoc(size int64) error {
+	itoc, err := readChunk(a.r, size, a.ItocOffset, signatureItoc)
+	if err != nil {
+		return err
+	}
+	a.itoc = itoc
+	if a.toc != nil {
+		return nil
+	}
+	for _, column := range []string{"DataL", "DataH"} {
+		data, err := itoc.Data(0, column)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		table, err := acb.NewCriUtfTable(bytes.NewReader(data), 0)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < int(table.NumberOfRows); i++ {
+			id, err := table.Uint(i, "ID")
+			if err != nil {
+				return err
+			}
+			fileSize, err := table.Uint(i, "FileSize")
+			if err != nil {
+				return err
+			}
+			extractSize, err := table.Uint(i, "ExtractSize")
+			if err != nil {
+				extractSize = fileSize
+			}
+			a.Files = append(a.Files, File{ID: uint32(id), FileSize: int64(fileSize), ExtractSize: int64(extractSize)})
+		}
+	}
+
+	sort.Slice(a.Files, func(i, j int) bool { return a.Files[i].ID < a.Files[j].ID })
+	offset := a.ContentOffset
+	for i := range a.Files {
+		a.Files[i].Offset = offset
+		offset = alignOffset(offset+a.Files[i].FileSize, a.Align)
+	}
+	return nil
+}
+
+func alignOffset(offset, align int64) int64 {
+	if align <= 1 {
+		return offset
+	}
+	return (offset + align - 1) / align * align
+}
+
+// OpenRaw returns reader of stored (maybe compressed) file data
+func (a *Archive) OpenRaw(f File) *io.SectionReader {
+	return io.NewSectionReader(a.r, f.Offset, f.FileSize)
+}
+
+// ReadRaw returns stored (maybe compressed) file data
+func (a *Archive) ReadRaw(f File) ([]byte, error) {
+	data := make([]byte, f.FileSize)
+	n, err := a.r.ReadAt(data, f.Offset)
+	if n < len(data) {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReadEntry returns file data, crilayla compressed data is decompressed
+func (a *Archive) ReadEntry(f File) ([]byte, error) {
+	data, err := a.ReadRaw(f)
+	if err != nil || !f.IsCompressed() {
+		return data, err
+	}
+	if !crilayla.IsCrilayla(data) {
+		return nil, ErrUnknownCompression
+	}
+	data, err = crilayla.Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != f.ExtractSize {
+		return nil, ErrExtractSize
+	}
+	return data, nil
+}
+
+// Lookup returns file entry of path
+func (a *Archive) Lookup(name string) (File, bool) {
+	i, ok := a.paths[name]
+	if !ok {
+		return File{}, false
+	}
+	return a.Files[i], true
+}
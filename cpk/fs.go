@@ -0,0 +1,178 @@
+package cpk
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// buildTree indexes file paths and directory entries for fs.FS
+func (a *Archive) buildTree() {
+	a.paths = make(map[string]int)
+	a.dirs = map[string][]string{".": nil}
+	for i, f := range a.Files {
+		name := f.Path()
+		if _, ok := a.paths[name]; ok {
+			continue
+		}
+		a.paths[name] = i
+		for {
+			dir := path.Dir(name)
+			_, exists := a.dirs[dir]
+			a.dirs[dir] = append(a.dirs[dir], path.Base(name))
+			if exists || dir == "." {
+				break
+			}
+			name = dir
+		}
+	}
+	for _, names := range a.dirs {
+		sort.Strings(names)
+	}
+}
+
+// Open opens file or directory in archive (fs.FS)
+func (a *Archive) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if i, ok := a.paths[name]; ok {
+		f := a.Files[i]
+		r, err := a.fileReader(f)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &file{SectionReader: r, info: fileInfo{name: path.Base(name), size: r.Size()}}, nil
+	}
+	if _, ok := a.dirs[name]; ok {
+		return &dir{a: a, path: name, info: fileInfo{name: path.Base(name), dir: true}}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// fileReader returns reader of file data
+func (a *Archive) fileReader(f File) (*io.SectionReader, error) {
+	if !f.IsCompressed() {
+		return a.OpenRaw(f), nil
+	}
+	data, err := a.ReadEntry(f)
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), nil
+}
+
+// ReadFile returns file data of path (fs.ReadFileFS)
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	f, ok := a.Lookup(name)
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+	return a.ReadEntry(f)
+}
+
+// ReadDir returns sorted directory entries (fs.ReadDirFS)
+func (a *Archive) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, ok := a.dirs[name]; !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return a.dirEntries(name), nil
+}
+
+func (a *Archive) dirEntries(name string) []fs.DirEntry {
+	names := a.dirs[name]
+	entries := make([]fs.DirEntry, len(names))
+	for i, child := range names {
+		childPath := path.Join(name, child)
+		info := fileInfo{name: child}
+		if _, ok := a.dirs[childPath]; ok {
+			info.dir = true
+		} else {
+			info.size = a.Files[a.paths[childPath]].ExtractSize
+		}
+		entries[i] = dirEntry{info}
+	}
+	return entries
+}
+
+// file is opened archive file, it is io.ReaderAt and io.Seeker
+type file struct {
+	*io.SectionReader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// dir is opened archive directory
+type dir struct {
+	a       *Archive
+	path    string
+	info    fileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: fs.ErrInvalid}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		d.entries = d.a.dirEntries(d.path)
+		d.read = true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// fileInfo is fs.FileInfo of archive entry
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// dirEntry is fs.DirEntry of archive entry
+type dirEntry struct {
+	info fileInfo
+}
+
+func (e dirEntry) Name() string               { return e.info.name }
+func (e dirEntry) IsDir() bool                { return e.info.dir }
+func (e dirEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e dirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
@@ -0,0 +1,332 @@
+package cpk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/vazrupe/go-acb/acb"
+)
+
+// ErrNoSpace is replaced data which can not be placed without moving other entries error
+var ErrNoSpace = errors.New("no space to replace file in place")
+
+// region is used byte range of archive
+type region struct {
+	start, end int64
+}
+
+// chunkSize returns chunk size of header and table, zero when offset is not chunk
+func (a *Archive) chunkSize(offset int64) int64 {
+	head := make([]byte, chunkHeaderSize)
+	_, err := a.r.ReadAt(head, offset)
+	if err != nil {
+		return 0
+	}
+	return chunkHeaderSize + int64(binary.LittleEndian.Uint64(head[8:]))
+}
+
+// regions returns used ranges of chunks and files except file of skip index
+func (a *Archive) regions(skip int) []region {
+	var regions []region
+	for _, name := range []string{"TocOffset", "ItocOffset", "EtocOffset", "GtocOffset"} {
+		offset := headerValue(a.Header, name)
+		if offset > 0 {
+			regions = append(regions, region{offset, offset + a.chunkSize(offset)})
+		}
+	}
+	for i, f := range a.Files {
+		if i != skip {
+			regions = append(regions, region{f.Offset, f.Offset + f.FileSize})
+		}
+	}
+	return regions
+}
+
+// spaceEnd returns end of free space from start, it is next used range or archive end
+func spaceEnd(regions []region, start, size int64) int64 {
+	end := size
+	for _, r := range regions {
+		if r.start > start && r.start < end {
+			end = r.start
+		}
+		if r.start <= start && start < r.end {
+			return start
+		}
+	}
+	return end
+}
+
+// setOptionalUint sets integer column value, missing column is skipped
+func setOptionalUint(tb *acb.CriUtfTable, row int, name string, v int64) error {
+	if !tb.HasColumn(name) {
+		return nil
+	}
+	return tb.SetUint(row, name, uint64(v))
+}
+
+// ReplaceFileInPlace replaces data of file and writes changes to w, the writer of archive read by a
+// (os.File opened with os.O_RDWR). other files are not moved: new data is written over the old data
+// when it fits, or appended at the archive end. tables which grow are also moved to the end.
+// id only archive can not move files, ErrNoSpace is returned when new data does not fit
+func (a *Archive) ReplaceFileInPlace(w io.WriterAt, name string, data []byte, compress bool) error {
+	i, ok := a.paths[name]
+	if !ok {
+		return ErrFileNotFound
+	}
+	old := a.Files[i]
+	// without extract size compressed data can not be detected
+	if a.toc != nil && !a.toc.HasColumn("ExtractSize") {
+		compress = false
+	}
+	stored := storeData(data, compress)
+	f := old
+	f.FileSize = int64(len(stored))
+	f.ExtractSize = int64(len(data))
+
+	end := alignOffset(a.size, a.Align)
+	regions := a.regions(i)
+	if f.Offset+f.FileSize > spaceEnd(regions, f.Offset, a.size) {
+		if a.toc == nil {
+			return ErrNoSpace
+		}
+		f.Offset = end
+		end = alignOffset(end+f.FileSize, a.Align)
+	}
+	if a.toc == nil && i+1 < len(a.Files) && alignOffset(f.Offset+f.FileSize, a.Align) != a.Files[i+1].Offset {
+		return ErrNoSpace
+	}
+	dataEnd := f.Offset + f.FileSize
+
+	// tables are updated on copies, a is changed after all writes succeed
+	header, err := copyTable(a.Header)
+	if err != nil {
+		return err
+	}
+	var tocChunk, itocChunk []byte
+	tocOffset, itocOffset := a.TocOffset, a.ItocOffset
+	if a.toc != nil {
+		toc, err := copyTable(a.toc)
+		if err != nil {
+			return err
+		}
+		err = setTocFile(toc, i, f, a.fileOffsetBase(tocOffset))
+		if err != nil {
+			return err
+		}
+		tocChunk, err = chunkBytes(signatureToc, toc)
+		if err != nil {
+			return err
+		}
+		if tocOffset+int64(len(tocChunk)) > spaceEnd(a.regionsWithout(regions, tocOffset), tocOffset, a.size) {
+			// file offsets are relative to toc or content offset, so all rows are rebased
+			tocOffset = alignOffset(maxOffset(end, dataEnd), chunkAlign)
+			base := a.fileOffsetBase(tocOffset)
+			for j, other := range a.Files {
+				if j == i {
+					other = f
+				}
+				err = setTocFile(toc, j, other, base)
+				if err != nil {
+					return err
+				}
+			}
+			tocChunk, err = chunkBytes(signatureToc, toc)
+			if err != nil {
+				return err
+			}
+			end = alignOffset(tocOffset+int64(len(tocChunk)), a.Align)
+		}
+	}
+	if a.itoc != nil {
+		itoc, err := copyTable(a.itoc)
+		if err != nil {
+			return err
+		}
+		changed, err := setItocFile(itoc, f)
+		if err != nil {
+			return err
+		}
+		if changed {
+			itocChunk, err = chunkBytes(signatureItoc, itoc)
+			if err != nil {
+				return err
+			}
+			if itocOffset+int64(len(itocChunk)) > spaceEnd(a.regionsWithout(regions, itocOffset), itocOffset, a.size) {
+				if a.toc == nil {
+					return ErrNoSpace
+				}
+				itocOffset = alignOffset(maxOffset(end, dataEnd, tocOffset+int64(len(tocChunk))), chunkAlign)
+			}
+		}
+	}
+
+	fileEnd := maxOffset(a.size, dataEnd, tocOffset+int64(len(tocChunk)), itocOffset+int64(len(itocChunk)))
+	contentEnd := maxOffset(a.ContentOffset+headerValue(header, "ContentSize"), dataEnd)
+	values := []struct {
+		name  string
+		value int64
+	}{
+		{"FileSize", fileEnd},
+		{"ContentSize", contentEnd - a.ContentOffset},
+		{"TocOffset", tocOffset},
+		{"ItocOffset", itocOffset},
+		{"EnabledPackedSize", headerValue(header, "EnabledPackedSize") + f.FileSize - old.FileSize},
+		{"EnabledDataSize", headerValue(header, "EnabledDataSize") + f.ExtractSize - old.ExtractSize},
+	}
+	if tocChunk != nil && headerValue(header, "TocSize") > 0 {
+		values = append(values, struct {
+			name  string
+			value int64
+		}{"TocSize", headerValue(header, "TocSize") - a.chunkSize(a.TocOffset) + int64(len(tocChunk))})
+	}
+	if itocChunk != nil && headerValue(header, "ItocSize") > 0 {
+		values = append(values, struct {
+			name  string
+			value int64
+		}{"ItocSize", headerValue(header, "ItocSize") - a.chunkSize(a.ItocOffset) + int64(len(itocChunk))})
+	}
+	for _, v := range values {
+		err = setOptionalUint(header, 0, v.name, v.value)
+		if err != nil {
+			return err
+		}
+	}
+	headerBytes, err := chunkBytes(signatureCpk, header)
+	if err != nil {
+		return err
+	}
+	limit := spaceEnd(regions, 0, a.size)
+	if limit > headerSpace-int64(len(copyright)) {
+		limit = headerSpace - int64(len(copyright))
+	}
+	if int64(len(headerBytes)) > a.chunkSize(0) && int64(len(headerBytes)) > limit {
+		return ErrNoSpace
+	}
+
+	// data and tables first, header last
+	parts := []struct {
+		offset int64
+		data   []byte
+	}{
+		{f.Offset, stored},
+		{tocOffset, tocChunk},
+		{itocOffset, itocChunk},
+		{0, headerBytes},
+	}
+	for _, part := range parts {
+		if part.data == nil {
+			continue
+		}
+		_, err = w.WriteAt(part.data, part.offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	// reload tables of written archive
+	updated, err := Open(a.r, fileEnd)
+	if err != nil {
+		return err
+	}
+	updated.closer = a.closer
+	*a = *updated
+	return nil
+}
+
+// fileOffsetBase returns base of toc file offset
+func (a *Archive) fileOffsetBase(tocOffset int64) int64 {
+	if a.ContentOffset > 0 && a.ContentOffset < tocOffset {
+		return a.ContentOffset
+	}
+	return tocOffset
+}
+
+// regionsWithout returns regions except the one starting at offset
+func (a *Archive) regionsWithout(regions []region, offset int64) []region {
+	var rest []region
+	for _, r := range regions {
+		if r.start != offset {
+			rest = append(rest, r)
+		}
+	}
+	return rest
+}
+
+func maxOffset(offsets ...int64) int64 {
+	max := offsets[0]
+	for _, offset := range offsets[1:] {
+		if offset > max {
+			max = offset
+		}
+	}
+	return max
+}
+
+// copyTable returns writable copy of table
+func copyTable(tb *acb.CriUtfTable) (*acb.CriUtfTable, error) {
+	data, err := tb.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return acb.NewCriUtfTable(bytes.NewReader(data), 0)
+}
+
+func setTocFile(toc *acb.CriUtfTable, row int, f File, base int64) error {
+	values := []struct {
+		name  string
+		value int64
+	}{
+		{"FileSize", f.FileSize},
+		{"ExtractSize", f.ExtractSize},
+		{"FileOffset", f.Offset - base},
+	}
+	for _, v := range values {
+		err := setOptionalUint(toc, row, v.name, v.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setItocFile sets file sizes in itoc id tables which have size columns
+func setItocFile(itoc *acb.CriUtfTable, f File) (changed bool, err error) {
+	for _, column := range []string{"DataL", "DataH"} {
+		data, err := itoc.Data(0, column)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		table, err := acb.NewCriUtfTable(bytes.NewReader(data), 0)
+		if err != nil {
+			return false, err
+		}
+		if !table.HasColumn("FileSize") {
+			continue
+		}
+		for row := range table.Rows {
+			id, err := table.Uint(row, "ID")
+			if err != nil {
+				return false, err
+			}
+			if uint32(id) != f.ID {
+				continue
+			}
+			err = setOptionalUint(table, row, "FileSize", f.FileSize)
+			if err != nil {
+				return false, err
+			}
+			err = setOptionalUint(table, row, "ExtractSize", f.ExtractSize)
+			if err != nil {
+				return false, err
+			}
+			data, err = table.Bytes()
+			if err != nil {
+				return false, err
+			}
+			return true, itoc.SetValue(0, column, data)
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,178 @@
+package cpk
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/vazrupe/go-acb/acb"
+)
+
+// memFile is in-memory archive file, WriteAt after the end grows it
+type memFile struct {
+	data []byte
+}
+
+func (m *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(m.data)) {
+		return 0, fmt.Errorf("read at %x after end %x", off, len(m.data))
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, fmt.Errorf("short read at %x", off)
+	}
+	return n, nil
+}
+
+func (m *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+func builtArchive(t *testing.T, itocOnly bool, files ...[]byte) []byte {
+	t.Helper()
+	b := NewBuilder(DefaultAlign)
+	b.ItocOnly = itocOnly
+	for i, data := range files {
+		err := b.AddFile(fmt.Sprintf("f%d", i), uint32(i), data, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// constantSizeArchive returns archive of three 4 byte files "dat0".. with toc right before content
+// and constant FileSize column, so toc grows when any file size changes
+func constantSizeArchive(t *testing.T) []byte {
+	t.Helper()
+	perrow := func(name string, columnType byte) acb.CriUtfColumn {
+		return acb.CriUtfColumn{Name: name, Type: columnType, Storage: acb.ColumnStoragePerrow}
+	}
+	constant := func(name string, v uint32) acb.CriUtfColumn {
+		return acb.CriUtfColumn{Name: name, Type: acb.ColumnType4Byte, Storage: acb.ColumnStorageConstant, Constant: acb.CriField{Value: v}}
+	}
+	toc, err := acb.CreateCriUtfTable("CpkTocInfo", []acb.CriUtfColumn{perrow("DirName", acb.ColumnTypeString), perrow("FileName", acb.ColumnTypeString),
+		constant("FileSize", 4), constant("ExtractSize", 4), perrow("FileOffset", acb.ColumnType8Byte), perrow("ID", acb.ColumnType4Byte)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err = toc.AppendRow(map[string]interface{}{"DirName": "", "FileName": fmt.Sprintf("f%d", i), "FileOffset": uint64(0), "ID": uint32(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tocChunk, err := chunkBytes(signatureToc, toc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tocOffset := int64(0x800)
+	content := alignOffset(tocOffset+int64(len(tocChunk)), 0x10)
+	for i := 0; i < 3; i++ {
+		err = toc.SetValue(i, "FileOffset", uint64(content+int64(i)*0x10-tocOffset))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tocChunk, err = chunkBytes(signatureToc, toc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := acb.CreateCriUtfTable("CpkHeader", []acb.CriUtfColumn{perrow("ContentOffset", acb.ColumnType8Byte), perrow("TocOffset", acb.ColumnType8Byte),
+		perrow("Align", acb.ColumnType2Byte), perrow("TocSize", acb.ColumnType8Byte)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = header.AppendRow(map[string]interface{}{"ContentOffset": uint64(content), "TocOffset": uint64(tocOffset), "Align": uint16(0x10), "TocSize": uint64(len(tocChunk))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerChunk, err := chunkBytes(signatureCpk, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &memFile{}
+	m.WriteAt(headerChunk, 0)
+	m.WriteAt(tocChunk, tocOffset)
+	for i := 0; i < 3; i++ {
+		m.WriteAt([]byte(fmt.Sprintf("dat%d", i)), content+int64(i)*0x10)
+	}
+	return m.data
+}
+
+func TestReplaceFileInPlace(t *testing.T) {
+	small := bytes.Repeat([]byte{1}, 1000)
+	cases := []struct {
+		name     string
+		archive  func(t *testing.T) []byte
+		file     string
+		data     []byte
+		err      error
+		moved    bool
+		tocMoved bool
+	}{
+		{"fits in place", func(t *testing.T) []byte { return builtArchive(t, false, small, []byte("next")) }, "f0", []byte("short"), nil, false, false},
+		{"grows and is appended", func(t *testing.T) []byte { return builtArchive(t, false, small, []byte("next")) }, "f0", make([]byte, 0x1000), nil, true, false},
+		{"toc grows and is relocated", constantSizeArchive, "f1", []byte("new!!"), nil, false, true},
+		{"itoc only grows", func(t *testing.T) []byte { return builtArchive(t, true, []byte("aaaa"), []byte("bbbb")) }, "00000.bin", make([]byte, 0x900), ErrNoSpace, false, false},
+	}
+	for _, c := range cases {
+		m := &memFile{data: c.archive(t)}
+		a, err := Open(m, int64(len(m.data)))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		want := map[string][]byte{}
+		offsets := map[string]int64{}
+		for _, f := range a.Files {
+			want[f.Path()], err = a.ReadEntry(f)
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			offsets[f.Path()] = f.Offset
+		}
+		tocOffset := a.TocOffset
+		original := append([]byte{}, m.data...)
+
+		err = a.ReplaceFileInPlace(m, c.file, c.data, false)
+		if err != c.err {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.err)
+			continue
+		}
+		if err != nil {
+			if !bytes.Equal(m.data, original) {
+				t.Errorf("%s: archive is changed by failed replace", c.name)
+			}
+			continue
+		}
+		want[c.file] = c.data
+		if (a.TocOffset != tocOffset) != c.tocMoved {
+			t.Errorf("%s: toc offset %x -> %x", c.name, tocOffset, a.TocOffset)
+		}
+
+		reopened, err := Open(m, int64(len(m.data)))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for _, archive := range []*Archive{a, reopened} {
+			for _, f := range archive.Files {
+				if moved := f.Offset != offsets[f.Path()]; moved != (c.moved && f.Path() == c.file) {
+					t.Errorf("%s: %s offset %x -> %x", c.name, f.Path(), offsets[f.Path()], f.Offset)
+				}
+				data, err := archive.ReadEntry(f)
+				if err != nil || !bytes.Equal(data, want[f.Path()]) {
+					t.Errorf("%s: %s = %q, %v", c.name, f.Path(), data, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,533 @@
+package cpk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/vazrupe/go-acb/acb"
+	"github.com/vazrupe/go-acb/crilayla"
+)
+
+// ErrFileExists is same path in archive error
+var ErrFileExists = errors.New("file already exists in archive")
+
+// ErrFileNotFound is missing file in archive error
+var ErrFileNotFound = errors.New("file not found in archive")
+
+// ErrIDConflict is same file id in archive error
+var ErrIDConflict = errors.New("file id already exists in archive")
+
+// ErrItocID is file id which does not fit in itoc error
+var ErrItocID = errors.New("itoc file id must be less than 0x10000")
+
+// DefaultAlign is file data alignment of new archive
+const DefaultAlign = 0x800
+
+// header chunk occupies the first 0x800 bytes, chunks after it are 0x800 aligned
+const (
+	headerSpace = 0x800
+	chunkAlign  = 0x800
+)
+
+// copyright is placed at the end of header space
+var copyright = []byte("(c)CRI")
+
+// Builder is cpk archive builder
+type Builder struct {
+	// Align is file data alignment
+	Align int64
+	// ItocOnly writes id only archive (ITOC without TOC and ETOC)
+	ItocOnly bool
+
+	files []buildFile
+}
+
+// buildFile is file entry with stored (maybe compressed) data
+type buildFile struct {
+	File
+	r io.ReaderAt
+}
+
+// NewBuilder returns empty archive builder
+func NewBuilder(align int64) *Builder {
+	if align < 1 {
+		align = DefaultAlign
+	}
+	return &Builder{Align: align}
+}
+
+// NewBuilderFromArchive returns builder of all files in a, stored data is copied as is
+func NewBuilderFromArchive(a *Archive) *Builder {
+	b := NewBuilder(a.Align)
+	b.ItocOnly = a.toc == nil
+	for _, f := range a.Files {
+		b.files = append(b.files, buildFile{File: f, r: a.OpenRaw(f)})
+	}
+	return b
+}
+
+// Files returns file entries, offsets are not set
+func (b *Builder) Files() []File {
+	files := make([]File, len(b.files))
+	for i, f := range b.files {
+		files[i] = f.File
+	}
+	return files
+}
+
+func (b *Builder) find(name string) int {
+	for i, f := range b.files {
+		if f.Path() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// storeData returns stored data, compressed only when it is smaller
+func storeData(data []byte, compress bool) []byte {
+	if compress {
+		compressed, err := crilayla.Compress(data)
+		if err == nil && len(compressed) < len(data) {
+			return compressed
+		}
+	}
+	return data
+}
+
+func newBuildFile(f File, data []byte, compress bool) buildFile {
+	stored := storeData(data, compress)
+	f.FileSize = int64(len(stored))
+	f.ExtractSize = int64(len(data))
+	return buildFile{File: f, r: bytes.NewReader(stored)}
+}
+
+// AddFile adds file of slash separated path and id
+// name is ignored (ID.bin) in itoc only archive, compress uses crilayla when it makes file smaller
+func (b *Builder) AddFile(name string, id uint32, data []byte, compress bool) error {
+	f := File{ID: id}
+	if !b.ItocOnly {
+		dir, file := path.Split(strings.Trim(name, "/"))
+		f.DirName = strings.TrimSuffix(dir, "/")
+		f.FileName = file
+	}
+	if b.find(f.Path()) >= 0 {
+		return ErrFileExists
+	}
+	for _, other := range b.files {
+		if other.ID == id {
+			return ErrIDConflict
+		}
+	}
+	b.files = append(b.files, newBuildFile(f, data, compress))
+	return nil
+}
+
+// ReplaceFile replaces data of file, id and name are kept
+func (b *Builder) ReplaceFile(name string, data []byte, compress bool) error {
+	i := b.find(name)
+	if i < 0 {
+		return ErrFileNotFound
+	}
+	b.files[i] = newBuildFile(b.files[i].File, data, compress)
+	return nil
+}
+
+// RemoveFile removes file of path
+func (b *Builder) RemoveFile(name string) error {
+	i := b.find(name)
+	if i < 0 {
+		return ErrFileNotFound
+	}
+	b.files = append(b.files[:i], b.files[i+1:]...)
+	return nil
+}
+
+// sortedFiles returns files in data order, toc is sorted by path and itoc only is sorted by id
+func (b *Builder) sortedFiles() []buildFile {
+	files := append([]buildFile{}, b.files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		if b.ItocOnly {
+			return files[i].ID < files[j].ID
+		}
+		return files[i].Path() < files[j].Path()
+	})
+	return files
+}
+
+// chunkBytes returns chunk of signature and table
+func chunkBytes(signature []byte, table *acb.CriUtfTable) ([]byte, error) {
+	data, err := table.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	chunk := make([]byte, chunkHeaderSize, chunkHeaderSize+len(data))
+	copy(chunk, signature)
+	chunk[4] = 0xFF
+	binary.LittleEndian.PutUint64(chunk[8:], uint64(len(data)))
+	return append(chunk, data...), nil
+}
+
+func perrowColumn(name string, columnType byte) acb.CriUtfColumn {
+	return acb.CriUtfColumn{Name: name, Type: columnType, Storage: acb.ColumnStoragePerrow}
+}
+
+// tocTable returns toc of files, file offset is relative to base
+func tocTable(files []buildFile, offsets []int64, base int64) (*acb.CriUtfTable, error) {
+	table, err := acb.CreateCriUtfTable("CpkTocInfo", []acb.CriUtfColumn{
+		perrowColumn("DirName", acb.ColumnTypeString),
+		perrowColumn("FileName", acb.ColumnTypeString),
+		perrowColumn("FileSize", acb.ColumnType4Byte),
+		perrowColumn("ExtractSize", acb.ColumnType4Byte),
+		perrowColumn("FileOffset", acb.ColumnType8Byte),
+		perrowColumn("ID", acb.ColumnType4Byte),
+		perrowColumn("UserString", acb.ColumnTypeString),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range files {
+		if f.FileSize > 0xFFFFFFFF || f.ExtractSize > 0xFFFFFFFF {
+			return nil, acb.ErrValueOverflow
+		}
+		err = table.AppendRow(map[string]interface{}{
+			"DirName":     f.DirName,
+			"FileName":    f.FileName,
+			"FileSize":    uint32(f.FileSize),
+			"ExtractSize": uint32(f.ExtractSize),
+			"FileOffset":  uint64(offsets[i] - base),
+			"ID":          f.ID,
+			"UserString":  f.UserString,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// itocTable returns id table, toc index is written with toc and file sizes without toc
+func itocTable(files []buildFile, withToc bool) (*acb.CriUtfTable, error) {
+	type itocRow struct {
+		id, index, fileSize, extractSize uint64
+	}
+	var low, high []itocRow
+	for i, f := range files {
+		if f.ID > 0xFFFF {
+			return nil, ErrItocID
+		}
+		row := itocRow{uint64(f.ID), uint64(i), uint64(f.FileSize), uint64(f.ExtractSize)}
+		if withToc && i <= 0xFFFF || !withToc && f.FileSize <= 0xFFFF && f.ExtractSize <= 0xFFFF {
+			low = append(low, row)
+		} else {
+			high = append(high, row)
+		}
+	}
+
+	nested := func(name string, rows []itocRow, valueType byte) ([]byte, error) {
+		if len(rows) == 0 {
+			return []byte{}, nil
+		}
+		columns := []acb.CriUtfColumn{perrowColumn("ID", acb.ColumnType2Byte)}
+		if withToc {
+			columns = append(columns, perrowColumn("TocIndex", valueType))
+		} else {
+			columns = append(columns, perrowColumn("FileSize", valueType), perrowColumn("ExtractSize", valueType))
+		}
+		table, err := acb.CreateCriUtfTable(name, columns)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i].id < rows[j].id })
+		for i, row := range rows {
+			err = table.AppendRow(nil)
+			if err != nil {
+				return nil, err
+			}
+			values := map[string]uint64{"ID": row.id, "TocIndex": row.index, "FileSize": row.fileSize, "ExtractSize": row.extractSize}
+			for _, column := range columns {
+				err = table.SetUint(i, column.Name, values[column.Name])
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		return table.Bytes()
+	}
+	dataL, err := nested("CpkItocL", low, acb.ColumnType2Byte)
+	if err != nil {
+		return nil, err
+	}
+	dataH, err := nested("CpkItocH", high, acb.ColumnType4Byte)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := acb.CreateCriUtfTable("CpkItocInfo", []acb.CriUtfColumn{
+		perrowColumn("FilesL", acb.ColumnType4Byte),
+		perrowColumn("FilesH", acb.ColumnType4Byte),
+		perrowColumn("DataL", acb.ColumnTypeData),
+		perrowColumn("DataH", acb.ColumnTypeData),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = table.AppendRow(map[string]interface{}{
+		"FilesL": uint32(len(low)),
+		"FilesH": uint32(len(high)),
+		"DataL":  dataL,
+		"DataH":  dataH,
+	})
+	return table, err
+}
+
+// etocTable returns extra toc of local directory names
+func etocTable(files []buildFile) (*acb.CriUtfTable, error) {
+	table, err := acb.CreateCriUtfTable("CpkEtocInfo", []acb.CriUtfColumn{
+		perrowColumn("UpdateDateTime", acb.ColumnType8Byte),
+		perrowColumn("LocalDir", acb.ColumnTypeString),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		err = table.AppendRow(map[string]interface{}{"LocalDir": f.DirName})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// headerTable returns cpk header table of values
+func headerTable(values map[string]uint64) (*acb.CriUtfTable, error) {
+	columns := []acb.CriUtfColumn{
+		perrowColumn("UpdateDateTime", acb.ColumnType8Byte),
+		perrowColumn("FileSize", acb.ColumnType8Byte),
+		perrowColumn("ContentOffset", acb.ColumnType8Byte),
+		perrowColumn("ContentSize", acb.ColumnType8Byte),
+		perrowColumn("TocOffset", acb.ColumnType8Byte),
+		perrowColumn("TocSize", acb.ColumnType8Byte),
+		perrowColumn("EtocOffset", acb.ColumnType8Byte),
+		perrowColumn("EtocSize", acb.ColumnType8Byte),
+		perrowColumn("ItocOffset", acb.ColumnType8Byte),
+		perrowColumn("ItocSize", acb.ColumnType8Byte),
+		perrowColumn("EnabledPackedSize", acb.ColumnType8Byte),
+		perrowColumn("EnabledDataSize", acb.ColumnType8Byte),
+		perrowColumn("Files", acb.ColumnType4Byte),
+		perrowColumn("Version", acb.ColumnType2Byte),
+		perrowColumn("Revision", acb.ColumnType2Byte),
+		perrowColumn("Align", acb.ColumnType2Byte),
+		perrowColumn("Sorted", acb.ColumnType2Byte),
+		perrowColumn("CpkMode", acb.ColumnType4Byte),
+	}
+	table, err := acb.CreateCriUtfTable("CpkHeader", columns)
+	if err != nil {
+		return nil, err
+	}
+	err = table.AppendRow(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range columns {
+		err = table.SetUint(0, column.Name, values[column.Name])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// headerChunk returns cpk header space with copyright at the end
+func headerChunk(table *acb.CriUtfTable) ([]byte, error) {
+	chunk, err := chunkBytes(signatureCpk, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunk) > headerSpace-len(copyright) {
+		return nil, ErrInvalidChunk
+	}
+	space := make([]byte, headerSpace)
+	copy(space, chunk)
+	copy(space[headerSpace-len(copyright):], copyright)
+	return space, nil
+}
+
+// WriteTo writes cpk archive to w
+// layout is header, toc, itoc, file data from content offset and etoc
+func (b *Builder) WriteTo(w io.Writer) (n int64, err error) {
+	if b.Align < 1 || b.Align > 0xFFFF {
+		return 0, acb.ErrValueOverflow
+	}
+	files := b.sortedFiles()
+	values := map[string]uint64{
+		"Files":    uint64(len(files)),
+		"Version":  7,
+		"Revision": 14,
+		"Align":    uint64(b.Align),
+		"Sorted":   1,
+		"CpkMode":  2,
+	}
+	if b.ItocOnly {
+		values["CpkMode"] = 0
+	}
+
+	// toc size does not depend on offsets, so it is built twice
+	offsets := make([]int64, len(files))
+	offset := int64(headerSpace)
+	var tocChunk, itocChunk, etocChunk []byte
+	if !b.ItocOnly {
+		toc, err := tocTable(files, offsets, 0)
+		if err != nil {
+			return 0, err
+		}
+		tocChunk, err = chunkBytes(signatureToc, toc)
+		if err != nil {
+			return 0, err
+		}
+		values["TocOffset"] = uint64(offset)
+		values["TocSize"] = uint64(len(tocChunk))
+		offset = alignOffset(offset+int64(len(tocChunk)), chunkAlign)
+	}
+	itoc, err := itocTable(files, !b.ItocOnly)
+	if err != nil {
+		return 0, err
+	}
+	itocChunk, err = chunkBytes(signatureItoc, itoc)
+	if err != nil {
+		return 0, err
+	}
+	values["ItocOffset"] = uint64(offset)
+	values["ItocSize"] = uint64(len(itocChunk))
+	offset = alignOffset(offset+int64(len(itocChunk)), chunkAlign)
+
+	contentOffset := alignOffset(offset, b.Align)
+	values["ContentOffset"] = uint64(contentOffset)
+	offset = contentOffset
+	for i, f := range files {
+		offsets[i] = offset
+		values["EnabledPackedSize"] += uint64(f.FileSize)
+		values["EnabledDataSize"] += uint64(f.ExtractSize)
+		offset = alignOffset(offset+f.FileSize, b.Align)
+		if i == len(files)-1 {
+			offset = offsets[i] + f.FileSize
+		}
+	}
+	values["ContentSize"] = uint64(offset - contentOffset)
+
+	if !b.ItocOnly {
+		toc, err := tocTable(files, offsets, int64(values["TocOffset"]))
+		if err != nil {
+			return 0, err
+		}
+		tocChunk, err = chunkBytes(signatureToc, toc)
+		if err != nil {
+			return 0, err
+		}
+		etoc, err := etocTable(files)
+		if err != nil {
+			return 0, err
+		}
+		etocChunk, err = chunkBytes(signatureEtoc, etoc)
+		if err != nil {
+			return 0, err
+		}
+		offset = alignOffset(offset, chunkAlign)
+		values["EtocOffset"] = uint64(offset)
+		values["EtocSize"] = uint64(len(etocChunk))
+		offset += int64(len(etocChunk))
+	}
+	values["FileSize"] = uint64(offset)
+
+	header, err := headerTable(values)
+	if err != nil {
+		return 0, err
+	}
+	space, err := headerChunk(header)
+	if err != nil {
+		return 0, err
+	}
+
+	ow := &offsetWriter{w: w}
+	defer func() { n = ow.n }()
+	parts := []struct {
+		offset int64
+		data   []byte
+	}{
+		{0, space},
+		{int64(values["TocOffset"]), tocChunk},
+		{int64(values["ItocOffset"]), itocChunk},
+	}
+	for _, part := range parts {
+		if len(part.data) == 0 {
+			continue
+		}
+		err = ow.writeAt(part.data, part.offset)
+		if err != nil {
+			return
+		}
+	}
+	for i, f := range files {
+		err = ow.pad(offsets[i])
+		if err != nil {
+			return
+		}
+		err = ow.copy(io.NewSectionReader(f.r, 0, f.FileSize), f.FileSize)
+		if err != nil {
+			return
+		}
+	}
+	if len(etocChunk) > 0 {
+		err = ow.writeAt(etocChunk, int64(values["EtocOffset"]))
+	}
+	return
+}
+
+// Bytes returns cpk archive data
+func (b *Builder) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := b.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// offsetWriter writes parts in offset order with zero padding
+type offsetWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (ow *offsetWriter) pad(offset int64) error {
+	if offset < ow.n {
+		return ErrInvalidChunk
+	}
+	written, err := ow.w.Write(make([]byte, offset-ow.n))
+	ow.n += int64(written)
+	return err
+}
+
+func (ow *offsetWriter) writeAt(data []byte, offset int64) error {
+	err := ow.pad(offset)
+	if err != nil {
+		return err
+	}
+	written, err := ow.w.Write(data)
+	ow.n += int64(written)
+	return err
+}
+
+func (ow *offsetWriter) copy(r io.Reader, size int64) error {
+	copied, err := io.Copy(ow.w, r)
+	ow.n += copied
+	if err == nil && copied != size {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
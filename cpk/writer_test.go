@@ -0,0 +1,59 @@
+package cpk
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBuildOpenRoundTrip(t *testing.T) {
+	for _, itocOnly := range []bool{false, true} {
+		files := []struct {
+			name     string
+			data     []byte
+			compress bool
+		}{
+			{"snd/bgm.acb", bytes.Repeat([]byte("@UTF table data "), 100), true},
+			{"snd/bgm.awb", []byte("stored as is"), false},
+			{"empty.bin", []byte{}, false},
+		}
+		b := NewBuilder(DefaultAlign)
+		b.ItocOnly = itocOnly
+		for i, f := range files {
+			err := b.AddFile(f.name, uint32(i), f.data, f.compress)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		data, err := b.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := Open(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a.Files) != len(files) {
+			t.Fatalf("itoc only %v: files = %+v", itocOnly, a.Files)
+		}
+		for _, entry := range a.Files {
+			if entry.ID >= uint32(len(files)) {
+				t.Fatalf("itoc only %v: unknown file %+v", itocOnly, entry)
+			}
+			f := files[entry.ID]
+			if !itocOnly && entry.Path() != f.name {
+				t.Errorf("file %d path = %s, want %s", entry.ID, entry.Path(), f.name)
+			}
+			if entry.Offset%DefaultAlign != 0 {
+				t.Errorf("itoc only %v: %s offset %x is not aligned", itocOnly, f.name, entry.Offset)
+			}
+			if entry.IsCompressed() != f.compress {
+				t.Errorf("itoc only %v: %s compressed = %v", itocOnly, f.name, entry.IsCompressed())
+			}
+			read, err := a.ReadEntry(entry)
+			if err != nil || !bytes.Equal(read, f.data) {
+				t.Errorf("itoc only %v: ReadEntry(%s) = %q, %v", itocOnly, f.name, read, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package crilayla
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrDataTooSmall is data smaller than raw header error
+var ErrDataTooSmall = errors.New("crilayla data must be at least 0x100 bytes")
+
+// match search parameters
+const (
+	minMatch    = 3
+	maxDistance = 1<<13 - 1 + minMatch
+	maxChain    = 256
+	hashBits    = 15
+)
+
+// bitWriter writes bits msb first, the bytes are reversed when finished
+type bitWriter struct {
+	buf      []byte
+	pool     byte
+	poolBits uint
+}
+
+func (bw *bitWriter) write(v uint, n uint) {
+	for n > 0 {
+		bits := 8 - bw.poolBits
+		if bits > n {
+			bits = n
+		}
+		bw.pool = bw.pool<<bits | byte(v>>(n-bits))&(1<<bits-1)
+		bw.poolBits += bits
+		n -= bits
+		if bw.poolBits == 8 {
+			bw.buf = append(bw.buf, bw.pool)
+			bw.pool, bw.poolBits = 0, 0
+		}
+	}
+}
+
+func (bw *bitWriter) bytes() []byte {
+	if bw.poolBits > 0 {
+		bw.buf = append(bw.buf, bw.pool<<(8-bw.poolBits))
+		bw.pool, bw.poolBits = 0, 0
+	}
+	out := make([]byte, len(bw.buf))
+	for i, b := range bw.buf {
+		out[len(out)-1-i] = b
+	}
+	return out
+}
+
+func (bw *bitWriter) writeLength(length int) {
+	rest := uint(length - minMatch)
+	for _, bits := range lengthBits {
+		max := uint(1)<<bits - 1
+		v := rest
+		if v > max {
+			v = max
+		}
+		bw.write(v, bits)
+		rest -= v
+		if v != max {
+			return
+		}
+	}
+	for {
+		v := rest
+		if v > 0xFF {
+			v = 0xFF
+		}
+		bw.write(v, 8)
+		rest -= v
+		if v != 0xFF {
+			return
+		}
+	}
+}
+
+func hash3(b []byte) int {
+	v := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+	return int((v * 2654435761) >> (32 - hashBits))
+}
+
+// Compress returns crilayla data, first 0x100 bytes are stored uncompressed
+func Compress(data []byte) ([]byte, error) {
+	if len(data) < rawHeaderSize {
+		return nil, ErrDataTooSmall
+	}
+	// decompressor writes the body from the end, so the body is compressed reversed
+	body := data[rawHeaderSize:]
+	r := make([]byte, len(body))
+	for i, b := range body {
+		r[len(r)-1-i] = b
+	}
+
+	head := make([]int, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int, len(r))
+	insert := func(i int) {
+		if i+minMatch > len(r) {
+			return
+		}
+		h := hash3(r[i:])
+		prev[i] = head[h]
+		head[h] = i
+	}
+
+	bw := &bitWriter{}
+	for i := 0; i < len(r); {
+		bestLength, bestDistance := 0, 0
+		if i+minMatch <= len(r) {
+			chain := 0
+			for j := head[hash3(r[i:])]; j >= 0 && chain < maxChain; j = prev[j] {
+				distance := i - j
+				if distance > maxDistance {
+					break
+				}
+				chain++
+				if distance < minMatch {
+					continue
+				}
+				length := 0
+				for i+length < len(r) && r[j+length] == r[i+length] {
+					length++
+				}
+				if length > bestLength {
+					bestLength, bestDistance = length, distance
+				}
+			}
+		}
+
+		if bestLength >= minMatch {
+			bw.write(1, 1)
+			bw.write(uint(bestDistance-minMatch), 13)
+			bw.writeLength(bestLength)
+			for k := 0; k < bestLength; k++ {
+				insert(i + k)
+			}
+			i += bestLength
+			continue
+		}
+		bw.write(0, 1)
+		bw.write(uint(r[i]), 8)
+		insert(i)
+		i++
+	}
+
+	compressed := bw.bytes()
+	out := make([]byte, headerSize, headerSize+len(compressed)+rawHeaderSize)
+	copy(out, Signature)
+	binary.LittleEndian.PutUint32(out[8:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(out[12:], uint32(len(compressed)))
+	out = append(out, compressed...)
+	out = append(out, data[:rawHeaderSize]...)
+	return out, nil
+}
@@ -0,0 +1,161 @@
+// Package crilayla is CRI CRILAYLA compression used by cpk and acb
+package crilayla
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Signature is CRILAYLA data signature
+var Signature = []byte("CRILAYLA")
+
+// crilayla layout: signature, uncompressed size (without raw header),
+// compressed size, compressed data read backwards, then raw first 0x100 bytes
+const (
+	headerSize    = 0x10
+	rawHeaderSize = 0x100
+)
+
+// ErrNotCrilayla is not crilayla data error
+var ErrNotCrilayla = errors.New("not crilayla data")
+
+// ErrBrokenData is broken compressed data error
+var ErrBrokenData = errors.New("broken crilayla data")
+
+// lengthBits is bit widths of match length levels, all bits set continues to next level
+var lengthBits = []uint{2, 3, 5, 8}
+
+// IsCrilayla reports whether data is started with crilayla signature
+func IsCrilayla(data []byte) bool {
+	return bytes.HasPrefix(data, Signature)
+}
+
+// DecompressedSize returns size of decompressed data
+func DecompressedSize(data []byte) (int, error) {
+	if len(data) < headerSize || !IsCrilayla(data) {
+		return 0, ErrNotCrilayla
+	}
+	return int(binary.LittleEndian.Uint32(data[8:])) + rawHeaderSize, nil
+}
+
+// NewReader returns reader of decompressed data in r
+func NewReader(r io.Reader) (*bytes.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err = Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// bitReader reads bits msb first from the end of data to the start
+type bitReader struct {
+	data     []byte
+	offset   int
+	pool     byte
+	poolBits uint
+}
+
+func (br *bitReader) read(n uint) (uint, error) {
+	var v uint
+	for n > 0 {
+		if br.poolBits == 0 {
+			if br.offset < 0 {
+				return 0, ErrBrokenData
+			}
+			br.pool = br.data[br.offset]
+			br.poolBits = 8
+			br.offset--
+		}
+		bits := n
+		if bits > br.poolBits {
+			bits = br.poolBits
+		}
+		v = v<<bits | uint(br.pool>>(br.poolBits-bits))&(1<<bits-1)
+		br.poolBits -= bits
+		n -= bits
+	}
+	return v, nil
+}
+
+// Decompress returns decompressed data
+func Decompress(data []byte) ([]byte, error) {
+	size, err := DecompressedSize(data)
+	if err != nil {
+		return nil, err
+	}
+	compressedSize := int(binary.LittleEndian.Uint32(data[12:]))
+	if compressedSize > len(data)-headerSize-rawHeaderSize {
+		return nil, ErrBrokenData
+	}
+	rawHeader := data[headerSize+compressedSize:]
+	out := make([]byte, size)
+	copy(out, rawHeader[:rawHeaderSize])
+
+	br := &bitReader{data: data[headerSize : headerSize+compressedSize], offset: compressedSize - 1}
+	// output is written backwards from the end
+	p := size - 1
+	for p >= rawHeaderSize {
+		flag, err := br.read(1)
+		if err != nil {
+			return nil, err
+		}
+		if flag == 0 {
+			v, err := br.read(8)
+			if err != nil {
+				return nil, err
+			}
+			out[p] = byte(v)
+			p--
+			continue
+		}
+
+		distance, err := br.read(13)
+		if err != nil {
+			return nil, err
+		}
+		length, err := readLength(br)
+		if err != nil {
+			return nil, err
+		}
+		src := p + int(distance) + 3
+		if src >= size || p-length+1 < rawHeaderSize {
+			return nil, ErrBrokenData
+		}
+		for i := 0; i < length; i++ {
+			out[p] = out[src]
+			p--
+			src--
+		}
+	}
+	return out, nil
+}
+
+func readLength(br *bitReader) (int, error) {
+	length := 3
+	for _, bits := range lengthBits {
+		v, err := br.read(bits)
+		if err != nil {
+			return 0, err
+		}
+		length += int(v)
+		if v != 1<<bits-1 {
+			return length, nil
+		}
+	}
+	for {
+		v, err := br.read(8)
+		if err != nil {
+			return 0, err
+		}
+		length += int(v)
+		if v != 0xFF {
+			return length, nil
+		}
+	}
+}
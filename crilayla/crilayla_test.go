@@ -0,0 +1,40 @@
+package crilayla
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	random := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("crilayla compresses the body reversed. "), 200)
+	for _, data := range [][]byte{
+		make([]byte, rawHeaderSize),
+		append(make([]byte, rawHeaderSize), 1, 2),
+		bytes.Repeat([]byte{7}, 100000),
+		random,
+		append(random[:rawHeaderSize:rawHeaderSize], text...),
+	} {
+		compressed, err := Compress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsCrilayla(compressed) {
+			t.Errorf("%d bytes: compressed data is not crilayla", len(data))
+		}
+		if size, err := DecompressedSize(compressed); err != nil || size != len(data) {
+			t.Errorf("%d bytes: DecompressedSize = %d, %v", len(data), size, err)
+		}
+		decompressed, err := Decompress(compressed)
+		if err != nil || !bytes.Equal(decompressed, data) {
+			t.Errorf("%d bytes: round trip failed (%v)", len(data), err)
+		}
+	}
+
+	_, err := Compress(make([]byte, rawHeaderSize-1))
+	if err != ErrDataTooSmall {
+		t.Errorf("err = %v, want ErrDataTooSmall", err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vazrupe/go-acb/acb"
+)
+
+func runDump(args []string) {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	flags.Usage = usage(flags, "dump [-format=json|yaml|text] UTF_FILEs...")
+	format := flags.String("format", "text", "output format: json, yaml or text")
+	flags.Parse(args)
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for _, filename := range flags.Args() {
+		table, err := loadUtfFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s Open Failed (%s)\n", filename, err)
+			continue
+		}
+		switch *format {
+		case "json":
+			err = dumpJSON(w, table)
+		case "yaml":
+			fmt.Fprintf(w, "# %s\n", filename)
+			err = dumpYAML(w, table, 0)
+		case "text":
+			fmt.Fprintf(w, "%s\n", filename)
+			dumpText(w, table, 1)
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown format `%s`\n", *format)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s Dump Failed (%s)\n", filename, err)
+		}
+	}
+}
+
+// loadUtfFile loads @UTF table file (acb, acf, ...)
+func loadUtfFile(filename string) (*acb.CriUtfTable, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return acb.NewCriUtfTable(bytes.NewReader(data), 0)
+}
+
+func dumpJSON(w io.Writer, table *acb.CriUtfTable) error {
+	data, err := table.DumpJSON()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = json.Indent(&buf, data, "", "  ")
+	if err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// perrowColumns returns columns stored in rows
+func perrowColumns(table *acb.CriUtfTable) []acb.CriUtfColumn {
+	var columns []acb.CriUtfColumn
+	for _, column := range table.Columns {
+		if column.Storage == acb.ColumnStoragePerrow {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+func dumpYAML(w io.Writer, table *acb.CriUtfTable, depth int) error {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%sTableName: %s\n", indent, yamlString(table.TableName))
+	fmt.Fprintf(w, "%sUnknown1: %d\n", indent, table.Unknown1)
+	if table.IsEncrypt {
+		fmt.Fprintf(w, "%sSeed: %d\n", indent, table.Seek)
+		fmt.Fprintf(w, "%sIncrement: %d\n", indent, table.Increment)
+	}
+	fmt.Fprintf(w, "%sDataAlignment: %d\n", indent, table.DataAlignment)
+	fmt.Fprintf(w, "%sRowSize: %d\n", indent, table.RowSize)
+
+	fmt.Fprintf(w, "%sColumns:\n", indent)
+	for _, column := range table.Columns {
+		fmt.Fprintf(w, "%s  - Name: %s\n", indent, yamlString(column.Name))
+		fmt.Fprintf(w, "%s    Type: %s\n", indent, column.TypeName())
+		fmt.Fprintf(w, "%s    Storage: %s\n", indent, column.StorageName())
+		if column.Storage == acb.ColumnStorageConstant || column.Storage == acb.ColumnStorageConstant2 {
+			err := dumpYAMLValue(w, "Constant", column.Constant, depth+2)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	columns := perrowColumns(table)
+	if len(table.Rows) == 0 {
+		fmt.Fprintf(w, "%sRows: []\n", indent)
+		return nil
+	}
+	fmt.Fprintf(w, "%sRows:\n", indent)
+	for _, row := range table.Rows {
+		if len(columns) == 0 {
+			fmt.Fprintf(w, "%s  - {}\n", indent)
+			continue
+		}
+		for i, column := range columns {
+			// first key of row follows list marker
+			var buf bytes.Buffer
+			err := dumpYAMLValue(&buf, column.Name, row[column.Name], depth+2)
+			if err != nil {
+				return err
+			}
+			line := buf.String()
+			if i == 0 {
+				line = indent + "  - " + line[len(indent)+4:]
+			}
+			io.WriteString(w, line)
+		}
+	}
+	return nil
+}
+
+func dumpYAMLValue(w io.Writer, key string, field acb.CriField, depth int) error {
+	indent := strings.Repeat("  ", depth)
+	if data, ok := field.Value.([]byte); ok {
+		if nested := acb.DecodeNestedTable(data); nested != nil {
+			fmt.Fprintf(w, "%s%s:\n", indent, yamlString(key))
+			return dumpYAML(w, nested, depth+1)
+		}
+		fmt.Fprintf(w, "%s%s: !!binary %s\n", indent, yamlString(key), strconv.Quote(base64.StdEncoding.EncodeToString(data)))
+		return nil
+	}
+	fmt.Fprintf(w, "%s%s: %s\n", indent, yamlString(key), formatValue(field, true))
+	return nil
+}
+
+// yamlString returns plain scalar when it is safe, or double quoted string
+func yamlString(s string) string {
+	if s == "" || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\\\n\t") || strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil || s[0] == '-' || s[0] == '?' {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func formatValue(field acb.CriField, quote bool) string {
+	switch v := field.Value.(type) {
+	case string:
+		if quote {
+			return yamlString(v)
+		}
+		return strconv.Quote(v)
+	case float32:
+		f := strconv.FormatFloat(float64(v), 'g', -1, 32)
+		if quote && (f == "NaN" || strings.HasSuffix(f, "Inf")) {
+			return strconv.Quote(f)
+		}
+		return f
+	case []byte:
+		if len(v) > 16 {
+			return fmt.Sprintf("data(%d bytes) %s...", len(v), hex.EncodeToString(v[:16]))
+		}
+		return fmt.Sprintf("data(%d bytes) %s", len(v), hex.EncodeToString(v))
+	}
+	if n, err := field.Int(); err == nil {
+		return strconv.FormatInt(n, 10)
+	}
+	u, _ := field.Uint()
+	return strconv.FormatUint(u, 10)
+}
+
+func dumpText(w io.Writer, table *acb.CriUtfTable, depth int) {
+	indent := strings.Repeat("  ", depth)
+	encrypted := ""
+	if table.IsEncrypt {
+		encrypted = fmt.Sprintf(", encrypted seed %d increment %d", table.Seek, table.Increment)
+	}
+	fmt.Fprintf(w, "%s@UTF %s (fields %d, rows %d, row size %d%s)\n", indent, table.TableName, len(table.Columns), len(table.Rows), table.RowSize, encrypted)
+	for _, column := range table.Columns {
+		fmt.Fprintf(w, "%s  column %s %s %s", indent, column.Name, column.TypeName(), column.StorageName())
+		if column.Storage == acb.ColumnStorageConstant || column.Storage == acb.ColumnStorageConstant2 {
+			dumpTextValue(w, column.Constant, depth+2)
+		} else {
+			fmt.Fprintln(w)
+		}
+	}
+
+	columns := perrowColumns(table)
+	for i, row := range table.Rows {
+		fmt.Fprintf(w, "%s  row %d\n", indent, i)
+		for _, column := range columns {
+			fmt.Fprintf(w, "%s    %s", indent, column.Name)
+			dumpTextValue(w, row[column.Name], depth+3)
+		}
+	}
+}
+
+func dumpTextValue(w io.Writer, field acb.CriField, depth int) {
+	if data, ok := field.Value.([]byte); ok {
+		if nested := acb.DecodeNestedTable(data); nested != nil {
+			fmt.Fprintln(w, ":")
+			dumpText(w, nested, depth)
+			return
+		}
+	}
+	fmt.Fprintln(w, " =", formatValue(field, false))
+}
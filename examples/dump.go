@@ -12,6 +12,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	defer a.Close()
 	for name, data := range a.Files() {
 		fmt.Printf("Write: %s\n", name)
 
@@ -1,27 +1,96 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/vazrupe/go-acb/acb"
+	"github.com/vazrupe/go-acb/adx"
+	"github.com/vazrupe/go-acb/hca"
+	"github.com/vazrupe/go-acb/wav"
 )
 
+// ExtractOptions is SaveAcb options
+type ExtractOptions struct {
+	Decode bool
+	Format wav.SampleFormat
+
+	// HcaKey is used for hca decode, and encrypted hca is saved decrypted when Decrypt
+	HcaKey  uint64
+	Decrypt bool
+
+	// AdxKey is "start,mult,add", keycode (type 9) or key string (type 8)
+	AdxKey string
+}
+
+// commands are subcommands, extract is used without subcommand
+var commands = map[string]func(args []string){
+	"extract":  runExtract,
+	"dump":     runDump,
+	"utf2json": runUtf2JSON,
+	"json2utf": runJSON2Utf,
+	"usm":      runUsm,
+	"list":     runList,
+	"verify":   runVerify,
+}
+
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if command, ok := commands[args[0]]; ok {
+			command(args[1:])
+			return
+		}
+	}
+	runExtract(args)
+}
+
+func usage(flags *flag.FlagSet, synopsis string) func() {
+	return func() {
+		fmt.Fprintf(flags.Output(), "Usage: go-acb %s\n", synopsis)
+		fmt.Fprintf(flags.Output(), "Commands: extract (default), dump, utf2json, json2utf, usm, list, verify\n")
+		flags.PrintDefaults()
+	}
+}
+
+func runExtract(args []string) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	flags.Usage = usage(flags, "[extract] [flags] ACB_FILEs...")
 	defaultDir := ""
-	saveDir := flag.String("save", defaultDir, "extract dir")
-	force := flag.Bool("f", false, "if an existing destination file cannot be opened, remove it and try again")
+	saveDir := flags.String("save", defaultDir, "extract dir")
+	force := flags.Bool("f", false, "if an existing destination file cannot be opened, remove it and try again")
+	decode := flags.Bool("decode", false, "decode hca and adx waveforms to wav")
+	floatWav := flags.Bool("float", false, "write decoded wav as 32bit float")
+	hcaKey := flags.String("hca-key", "", "hca keycode (decimal or 0x hex). encrypted hca is saved decrypted")
+	adxKey := flags.String("adx-key", "", "adx key: start,mult,add triplet, keycode (type 9) or key string (type 8)")
+
+	flags.Parse(args)
+	files := flags.Args()
 
-	flag.Parse()
-	files := flag.Args()
+	opts := &ExtractOptions{Decode: *decode, Format: wav.PCM16, AdxKey: *adxKey}
+	if *floatWav {
+		opts.Format = wav.Float32
+	}
+	if *hcaKey != "" {
+		key, err := strconv.ParseUint(*hcaKey, 0, 64)
+		if err != nil {
+			fmt.Printf("Error: invalid hca key `%s`\n", *hcaKey)
+			os.Exit(2)
+		}
+		opts.HcaKey = key
+		opts.Decrypt = true
+	}
 
 	var saveRoot string
 	for _, filename := range files {
 		f, err := acb.LoadCriAcbFile(filename)
 		if err != nil {
 			fmt.Printf("Error: %s Open Failed (%s)\n", filename, err)
+			continue
 		}
 
 		name := filepath.Base(filename)
@@ -37,11 +106,13 @@ func main() {
 		if _, err := os.Stat(saveRoot); err == nil {
 			if !*force {
 				fmt.Printf("Exists: directory `%s`. skip\n", saveRoot)
+				f.Close()
 				continue
 			}
 			RemoveDir(saveRoot)
 		}
-		i := SaveAcb(saveRoot, f)
+		i := SaveAcb(saveRoot, f, opts)
+		f.Close()
 		fmt.Printf("Extract: %s -> %s (%d files)\n", name, saveRoot, i)
 	}
 }
@@ -67,24 +138,86 @@ func RemoveDir(dir string) error {
 }
 
 // SaveAcb is extract AcbFile on target dir
-func SaveAcb(savedir string, a *acb.CriAcbFile) int {
+func SaveAcb(savedir string, a *acb.CriAcbFile, opts *ExtractOptions) int {
 	i := 0
 	for _, cue := range a.Cue {
-		file, ok := a.InternalAwb.Files[uint16(cue.CueID)]
-		if !ok {
-			continue
-		}
+		for j, waveform := range cue.Waveforms {
+			data, err := a.CueWaveformData(waveform)
+			if err != nil {
+				continue
+			}
+
+			name := cue.WaveformFileName(j)
+			name, data = convertWaveform(a, waveform, name, data, opts)
 
-		savename := fmt.Sprintf("%s%s", cue.CueName, cue.GetFileExtension())
-		savePath := filepath.Join(savedir, savename)
-		os.MkdirAll(savedir, os.ModeDir)
+			savePath := filepath.Join(savedir, name)
+			os.MkdirAll(savedir, os.ModeDir)
 
-		f, err := os.Create(savePath)
-		if err == nil {
-			i++
+			f, err := os.Create(savePath)
+			if err != nil {
+				continue
+			}
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				i++
+			}
 		}
-		defer f.Close()
-		f.Write(file.Data)
 	}
 	return i
 }
+
+func convertWaveform(a *acb.CriAcbFile, waveform acb.CriAcbCueWaveform, name string, data []byte, opts *ExtractOptions) (string, []byte) {
+	if opts.Decode && adx.IsAdx(data) {
+		key, err := adxKey(a, waveform, data, opts)
+		if err != nil {
+			return waveFile(name, data, nil, err)
+		}
+		wave, err := adx.DecodeWaveWithKey(bytes.NewReader(data), key, opts.Format)
+		return waveFile(name, data, wave, err)
+	}
+	if !hca.IsHca(data) {
+		return name, data
+	}
+	keycode := a.HcaKeycode(waveform, opts.HcaKey)
+	if opts.Decode {
+		wave, err := hca.DecodeWaveWithKey(bytes.NewReader(data), keycode, opts.Format)
+		return waveFile(name, data, wave, err)
+	}
+	if opts.Decrypt {
+		decrypted, err := hca.Decrypt(data, keycode)
+		if err != nil {
+			fmt.Printf("Warning: %s decrypt failed (%s). save raw data\n", name, err)
+			return name, data
+		}
+		return name, decrypted
+	}
+	return name, data
+}
+
+// waveFile returns wav name and data, or raw data when decode failed
+func waveFile(name string, data []byte, wave *wav.Wave, err error) (string, []byte) {
+	if err != nil {
+		fmt.Printf("Warning: %s decode failed (%s). save raw data\n", name, err)
+		return name, data
+	}
+	var buf bytes.Buffer
+	wave.WriteTo(&buf)
+	return name[:len(name)-len(filepath.Ext(name))] + ".wav", buf.Bytes()
+}
+
+func adxKey(a *acb.CriAcbFile, waveform acb.CriAcbCueWaveform, data []byte, opts *ExtractOptions) (adx.Key, error) {
+	if opts.AdxKey == "" {
+		return adx.Key{}, nil
+	}
+	h, err := adx.ParseHeader(data)
+	if err != nil {
+		return adx.Key{}, err
+	}
+	if h.Flags == 0 {
+		return adx.Key{}, nil
+	}
+	return adx.ParseKey(opts.AdxKey, h.Flags, a.WaveformSubkey(waveform))
+}
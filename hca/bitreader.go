@@ -0,0 +1,62 @@
+package hca
+
+// bitReader reads msb first bits from frame
+type bitReader struct {
+	data []byte
+	bit  int
+	size int
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data, size: len(data) * 8}
+}
+
+// peek returns next n (<= 32) bits without moving. bits past end read as 0
+func (br *bitReader) peek(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		pos := br.bit + i
+		v <<= 1
+		if pos < br.size {
+			v |= uint32(br.data[pos>>3]>>(7-uint(pos&7))) & 1
+		}
+	}
+	return v
+}
+
+func (br *bitReader) read(n int) uint32 {
+	v := br.peek(n)
+	br.bit += n
+	return v
+}
+
+// skip moves n bits. n may be negative
+func (br *bitReader) skip(n int) {
+	br.bit += n
+}
+
+var crc16Table [256]uint16
+
+func init() {
+	// polynomial 0x8005, no reflection
+	for i := range crc16Table {
+		c := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if c&0x8000 != 0 {
+				c = c<<1 ^ 0x8005
+			} else {
+				c <<= 1
+			}
+		}
+		crc16Table[i] = c
+	}
+}
+
+// crc16 returns 0 when data ends with its own checksum
+func crc16(data []byte) uint16 {
+	var sum uint16
+	for _, b := range data {
+		sum = sum<<8 ^ crc16Table[byte(sum>>8)^b]
+	}
+	return sum
+}
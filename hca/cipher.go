@@ -0,0 +1,137 @@
+package hca
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// cipher types
+const (
+	CiphTypeNone   = 0
+	CiphTypeStatic = 1
+	CiphTypeKeyed  = 56
+)
+
+// ErrUnknownCipher is unknown ciph type error
+var ErrUnknownCipher = errors.New("unknown hca cipher type")
+
+// MixKey returns keycode mixed with awb subkey. subkey 0 keeps keycode
+func MixKey(keycode uint64, subkey uint16) uint64 {
+	if subkey == 0 {
+		return keycode
+	}
+	return keycode * (uint64(subkey)<<16 | uint64(uint16(^subkey)+2))
+}
+
+// newCipherTable returns byte substitution table for frame decryption
+func newCipherTable(ciphType uint16, keycode uint64) (table [256]byte, err error) {
+	// keyed cipher without keycode is not encrypted
+	if ciphType == CiphTypeKeyed && keycode == 0 {
+		ciphType = CiphTypeNone
+	}
+	switch ciphType {
+	case CiphTypeNone:
+		for i := range table {
+			table[i] = byte(i)
+		}
+	case CiphTypeStatic:
+		v := 0
+		for i := 1; i < 0xFF; i++ {
+			v = (v*13 + 11) & 0xFF
+			if v == 0 || v == 0xFF {
+				v = (v*13 + 11) & 0xFF
+			}
+			table[i] = byte(v)
+		}
+		table[0] = 0
+		table[0xFF] = 0xFF
+	case CiphTypeKeyed:
+		table = keyedCipherTable(keycode)
+	default:
+		err = ErrUnknownCipher
+	}
+	return
+}
+
+func keyedCipherTable(keycode uint64) (table [256]byte) {
+	keycode--
+	var kc [8]byte
+	binary.LittleEndian.PutUint64(kc[:], keycode)
+
+	seed := [16]byte{
+		kc[1], kc[1] ^ kc[6], kc[2] ^ kc[3], kc[2],
+		kc[2] ^ kc[1], kc[3] ^ kc[4], kc[3], kc[3] ^ kc[2],
+		kc[4] ^ kc[5], kc[4], kc[4] ^ kc[3], kc[5] ^ kc[6],
+		kc[5], kc[5] ^ kc[4], kc[6] ^ kc[1], kc[6],
+	}
+
+	var base [256]byte
+	rows := nibbleTable(kc[0])
+	for r := 0; r < 16; r++ {
+		cols := nibbleTable(seed[r])
+		for c := 0; c < 16; c++ {
+			base[r*16+c] = rows[r]<<4 | cols[c]
+		}
+	}
+
+	x := 0
+	pos := 1
+	for i := 0; i < 256; i++ {
+		x = (x + 17) & 0xFF
+		if base[x] != 0 && base[x] != 0xFF {
+			table[pos] = base[x]
+			pos++
+		}
+	}
+	table[0] = 0
+	table[0xFF] = 0xFF
+	return
+}
+
+func nibbleTable(key byte) (table [16]byte) {
+	mul := int(key&1)<<3 | 5
+	add := int(key&0xE) | 1
+	v := int(key >> 4)
+	for i := range table {
+		v = (v*mul + add) & 0xF
+		table[i] = byte(v)
+	}
+	return
+}
+
+// Decrypt returns copy of hca data rewritten as unencrypted (ciph type 0) stream
+func Decrypt(data []byte, keycode uint64) ([]byte, error) {
+	h, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	copy(out, data)
+	if h.CiphType == CiphTypeNone {
+		return out, nil
+	}
+	if h.VbrMaxFrameSize > 0 {
+		return nil, ErrUnsupported
+	}
+
+	table, err := newCipherTable(h.CiphType, keycode)
+	if err != nil {
+		return nil, err
+	}
+
+	// frames: decrypt and fix crc
+	frameSize := int(h.FrameSize)
+	for pos := int(h.HeaderSize); pos+frameSize <= len(out); pos += frameSize {
+		frame := out[pos : pos+frameSize]
+		for i, b := range frame {
+			frame[i] = table[b]
+		}
+		binary.BigEndian.PutUint16(frame[frameSize-2:], crc16(frame[:frameSize-2]))
+	}
+
+	// header: ciph type 0 and fix crc
+	header := out[:h.HeaderSize]
+	binary.BigEndian.PutUint16(header[h.ciphOffset:], CiphTypeNone)
+	binary.BigEndian.PutUint16(header[len(header)-2:], crc16(header[:len(header)-2]))
+	return out, nil
+}
@@ -0,0 +1,37 @@
+package hca
+
+import "testing"
+
+func TestKeyedCipherWithoutKey(t *testing.T) {
+	table, err := newCipherTable(CiphTypeKeyed, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range table {
+		if int(b) != i {
+			t.Fatalf("table[%d] = %d, want identity table", i, b)
+		}
+	}
+}
+
+func TestCipherTablePermutation(t *testing.T) {
+	for _, c := range []struct {
+		ciphType uint16
+		keycode  uint64
+	}{{CiphTypeStatic, 0}, {CiphTypeKeyed, 1}, {CiphTypeKeyed, 0x30DBE1AB}} {
+		table, err := newCipherTable(c.ciphType, c.keycode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var seen [256]bool
+		for _, b := range table {
+			seen[b] = true
+		}
+		for i, ok := range seen {
+			if !ok {
+				t.Errorf("type %d key %x: %d is missing from table", c.ciphType, c.keycode, i)
+				break
+			}
+		}
+	}
+}
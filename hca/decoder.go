@@ -0,0 +1,524 @@
+package hca
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrUnsupported is unsupported hca feature error
+var ErrUnsupported = errors.New("unsupported hca stream")
+
+// ErrBrokenFrame is frame sync or unpack error
+var ErrBrokenFrame = errors.New("broken hca frame")
+
+type channel struct {
+	typ        int
+	codedCount int
+
+	intensity    [subframes]byte
+	scalefactors [samplesPerSubframe]byte
+	resolution   [samplesPerSubframe]byte
+	noises       [samplesPerSubframe]byte
+	noiseCount   int
+	validCount   int
+
+	gain          [samplesPerSubframe]float32
+	spectra       [subframes][samplesPerSubframe]float32
+	dct           [samplesPerSubframe]float32
+	imdctPrevious [samplesPerSubframe]float32
+	wave          [subframes][samplesPerSubframe]float32
+}
+
+// Decoder is hca frame decoder
+type Decoder struct {
+	Header
+
+	r             io.Reader
+	frame         []byte
+	cipherTable   [256]byte
+	framesRead    uint32
+	hfrGroupCount int
+	athCurve      [samplesPerSubframe]byte
+	channels      []channel
+	random        uint32
+}
+
+// NewDecoder reads hca header from r and returns decoder for unencrypted or ciph type 1 stream
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	return NewDecoderWithKey(r, 0)
+}
+
+// NewDecoderWithKey reads hca header from r and returns decoder using keycode
+// keycode must be mixed with awb subkey by MixKey
+func NewDecoderWithKey(r io.Reader, keycode uint64) (*Decoder, error) {
+	head := make([]byte, 8)
+	_, err := io.ReadFull(r, head)
+	if err != nil {
+		return nil, err
+	}
+	size, err := HeaderSize(head)
+	if err != nil {
+		return nil, err
+	}
+	if size < 8 {
+		return nil, ErrInvalidHeader
+	}
+	data := make([]byte, size)
+	copy(data, head)
+	_, err = io.ReadFull(r, data[8:])
+	if err != nil {
+		return nil, err
+	}
+	header, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.VbrMaxFrameSize > 0 {
+		return nil, ErrUnsupported
+	}
+	cipherTable, err := newCipherTable(header.CiphType, keycode)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Decoder{
+		Header:        *header,
+		r:             r,
+		frame:         make([]byte, header.FrameSize),
+		cipherTable:   cipherTable,
+		hfrGroupCount: header.hfrGroupCount(),
+		random:        defaultRandom,
+	}
+	d.initializeAthCurve()
+
+	d.channels = make([]channel, d.Channels)
+	for i, typ := range d.channelTypes() {
+		d.channels[i].typ = typ
+		d.channels[i].codedCount = int(d.BaseBandCount)
+		if typ != channelTypeStereoSecondary {
+			d.channels[i].codedCount += int(d.StereoBandCount)
+		}
+	}
+	return d, nil
+}
+
+func (d *Decoder) initializeAthCurve() {
+	if d.AthType != 1 {
+		return
+	}
+	acc := 0
+	for i := range d.athCurve {
+		acc += d.SampleRate
+		index := acc >> 13
+		if index >= len(athBaseCurve)-2 {
+			for j := i; j < len(d.athCurve); j++ {
+				d.athCurve[j] = 0xFF
+			}
+			break
+		}
+		d.athCurve[i] = athBaseCurve[index]
+	}
+}
+
+// DecodeFrame decodes next frame and returns interleaved samples (1024 per channel)
+// returns io.EOF after last frame
+func (d *Decoder) DecodeFrame() ([]float32, error) {
+	if d.framesRead >= d.FrameCount {
+		return nil, io.EOF
+	}
+	_, err := io.ReadFull(d.r, d.frame)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	d.framesRead++
+
+	err = d.decodeFrame(d.frame)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]float32, samplesPerFrame*d.Channels)
+	n := 0
+	for sf := 0; sf < subframes; sf++ {
+		for i := 0; i < samplesPerSubframe; i++ {
+			for ch := range d.channels {
+				samples[n] = d.channels[ch].wave[sf][i]
+				n++
+			}
+		}
+	}
+	return samples, nil
+}
+
+// DecodeAll decodes all frames and returns interleaved samples without encoder delay and padding
+func (d *Decoder) DecodeAll() ([]float32, error) {
+	numSamples := d.NumSamples()
+	if numSamples < 0 {
+		numSamples = 0
+	}
+	skip := int(d.EncoderDelay) * d.Channels
+	samples := make([]float32, 0, numSamples*d.Channels)
+	for {
+		frame, err := d.DecodeFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if skip >= len(frame) {
+			skip -= len(frame)
+			continue
+		}
+		samples = append(samples, frame[skip:]...)
+		skip = 0
+	}
+	if len(samples) > numSamples*d.Channels {
+		samples = samples[:numSamples*d.Channels]
+	}
+	return samples, nil
+}
+
+func (d *Decoder) decodeFrame(frame []byte) error {
+	if crc16(frame) != 0 {
+		return ErrChecksum
+	}
+	for i, b := range frame {
+		frame[i] = d.cipherTable[b]
+	}
+	br := newBitReader(frame)
+	if br.read(16) != 0xFFFF {
+		return ErrBrokenFrame
+	}
+	acceptableNoiseLevel := int(br.read(9))
+	evaluationBoundary := int(br.read(7))
+	packedNoiseLevel := (acceptableNoiseLevel << 8) - evaluationBoundary
+
+	for i := range d.channels {
+		ch := &d.channels[i]
+		err := d.unpackScalefactors(ch, br)
+		if err != nil {
+			return err
+		}
+		err = d.unpackIntensity(ch, br)
+		if err != nil {
+			return err
+		}
+		d.calculateResolution(ch, packedNoiseLevel)
+		ch.calculateGain()
+	}
+
+	for sf := 0; sf < subframes; sf++ {
+		for i := range d.channels {
+			d.channels[i].dequantizeCoefficients(br, sf)
+		}
+		for i := range d.channels {
+			d.reconstructNoise(&d.channels[i], sf)
+			d.reconstructHighFrequency(&d.channels[i], sf)
+		}
+		if d.StereoBandCount > 0 {
+			for i := 0; i+1 < len(d.channels); i++ {
+				d.applyIntensityStereo(i, sf)
+				d.applyMsStereo(i, sf)
+			}
+		}
+		for i := range d.channels {
+			d.channels[i].imdctTransform(sf)
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) unpackScalefactors(ch *channel, br *bitReader) error {
+	count := ch.codedCount
+	extraCount := 0
+	deltaBits := int(br.read(3))
+
+	// v3.0 stores hfr scales after coded scalefactors
+	if ch.typ != channelTypeStereoSecondary && d.hfrGroupCount > 0 && d.Version > Version200 {
+		extraCount = d.hfrGroupCount
+		count += extraCount
+		if count > samplesPerSubframe {
+			return ErrBrokenFrame
+		}
+	}
+
+	if deltaBits >= 6 {
+		for i := 0; i < count; i++ {
+			ch.scalefactors[i] = byte(br.read(6))
+		}
+	} else if deltaBits > 0 {
+		expectedDelta := 1<<uint(deltaBits) - 1
+		value := int(br.read(6))
+		ch.scalefactors[0] = byte(value)
+		for i := 1; i < count; i++ {
+			delta := int(br.read(deltaBits))
+			if delta == expectedDelta {
+				value = int(br.read(6))
+			} else {
+				value = value - expectedDelta>>1 + delta
+				if value < 0 || value >= 64 {
+					return ErrBrokenFrame
+				}
+			}
+			ch.scalefactors[i] = byte(value)
+		}
+	} else {
+		for i := range ch.scalefactors {
+			ch.scalefactors[i] = 0
+		}
+	}
+
+	for i := 0; i < extraCount; i++ {
+		ch.scalefactors[samplesPerSubframe-1-i] = ch.scalefactors[count-1-i]
+	}
+	return nil
+}
+
+func (d *Decoder) unpackIntensity(ch *channel, br *bitReader) error {
+	if ch.typ != channelTypeStereoSecondary {
+		// v3.0 reads hfr scales in unpackScalefactors
+		if d.Version <= Version200 {
+			hfrScales := ch.scalefactors[samplesPerSubframe-d.hfrGroupCount:]
+			for i := range hfrScales {
+				hfrScales[i] = byte(br.read(6))
+			}
+		}
+		return nil
+	}
+
+	value := int(br.peek(4))
+	if d.Version <= Version200 {
+		ch.intensity[0] = byte(value)
+		if value < 15 {
+			br.skip(4)
+			for i := 1; i < subframes; i++ {
+				ch.intensity[i] = byte(br.read(4))
+			}
+		}
+		return nil
+	}
+
+	br.skip(4)
+	if value >= 15 {
+		for i := range ch.intensity {
+			ch.intensity[i] = 7
+		}
+		return nil
+	}
+	deltaBits := int(br.read(2))
+	ch.intensity[0] = byte(value)
+	if deltaBits == 3 {
+		for i := 1; i < subframes; i++ {
+			ch.intensity[i] = byte(br.read(4))
+		}
+		return nil
+	}
+	bmax := 2<<uint(deltaBits) - 1
+	bits := deltaBits + 1
+	for i := 1; i < subframes; i++ {
+		delta := int(br.read(bits))
+		if delta == bmax {
+			value = int(br.read(4))
+		} else {
+			value = value - bmax>>1 + delta
+			if value < 0 || value > 15 {
+				return ErrBrokenFrame
+			}
+		}
+		ch.intensity[i] = byte(value)
+	}
+	return nil
+}
+
+func (d *Decoder) calculateResolution(ch *channel, packedNoiseLevel int) {
+	noiseCount := 0
+	validCount := 0
+	for i := 0; i < ch.codedCount; i++ {
+		resolution := 0
+		scalefactor := int(ch.scalefactors[i])
+		if scalefactor > 0 {
+			noiseLevel := int(d.athCurve[i]) + (packedNoiseLevel+i)>>8
+			curvePosition := noiseLevel + 1 - (5*scalefactor)>>1
+			if curvePosition < 0 {
+				resolution = 15
+			} else if curvePosition < len(invertTable) {
+				resolution = int(invertTable[curvePosition])
+			}
+
+			if resolution > int(d.MaxResolution) {
+				resolution = int(d.MaxResolution)
+			} else if resolution < int(d.MinResolution) {
+				resolution = int(d.MinResolution)
+			}
+
+			// noise indexes from head, valid indexes from tail
+			if resolution < 1 {
+				ch.noises[noiseCount] = byte(i)
+				noiseCount++
+			} else {
+				ch.noises[samplesPerSubframe-1-validCount] = byte(i)
+				validCount++
+			}
+		}
+		ch.resolution[i] = byte(resolution)
+	}
+	for i := ch.codedCount; i < samplesPerSubframe; i++ {
+		ch.resolution[i] = 0
+	}
+	ch.noiseCount = noiseCount
+	ch.validCount = validCount
+}
+
+func (ch *channel) calculateGain() {
+	for i := 0; i < ch.codedCount; i++ {
+		ch.gain[i] = dequantizerScalingTable[ch.scalefactors[i]] * quantizerStepSize[ch.resolution[i]]
+	}
+}
+
+func (ch *channel) dequantizeCoefficients(br *bitReader, sf int) {
+	spectra := &ch.spectra[sf]
+	for i := 0; i < ch.codedCount; i++ {
+		resolution := ch.resolution[i]
+		bits := int(maxBitTable[resolution])
+		code := int(br.read(bits))
+
+		var qc float32
+		if resolution > 7 {
+			// sign-magnitude, lowest bit is sign
+			value := code >> 1
+			if code&1 != 0 {
+				value = -value
+			}
+			if value == 0 {
+				// zero has no sign bit
+				br.skip(-1)
+			}
+			qc = float32(value)
+		} else {
+			index := int(resolution)<<4 + code
+			br.skip(int(readBitTable[index]) - bits)
+			qc = readValTable[index]
+		}
+		spectra[i] = ch.gain[i] * qc
+	}
+	for i := ch.codedCount; i < samplesPerSubframe; i++ {
+		spectra[i] = 0
+	}
+}
+
+func (d *Decoder) reconstructNoise(ch *channel, sf int) {
+	if d.MinResolution > 0 {
+		return
+	}
+	if ch.validCount <= 0 || ch.noiseCount <= 0 {
+		return
+	}
+	if d.MsStereo != 0 && ch.typ != channelTypeStereoPrimary {
+		return
+	}
+
+	spectra := &ch.spectra[sf]
+	for i := 0; i < ch.noiseCount; i++ {
+		d.random = 0x343FD*d.random + 0x269EC3
+		randomIndex := samplesPerSubframe - ch.validCount + int((d.random&0x7FFF)*uint32(ch.validCount)>>15)
+
+		noiseIndex := ch.noises[i]
+		validIndex := ch.noises[randomIndex]
+		scIndex := int(ch.scalefactors[noiseIndex]) - int(ch.scalefactors[validIndex]) + 62
+		if scIndex < 0 {
+			scIndex = 0
+		}
+		spectra[noiseIndex] = scaleConversionTable[scIndex] * spectra[validIndex]
+	}
+}
+
+func (d *Decoder) reconstructHighFrequency(ch *channel, sf int) {
+	if ch.typ == channelTypeStereoSecondary || d.BandsPerHfrGroup == 0 {
+		return
+	}
+	startBand := int(d.StereoBandCount) + int(d.BaseBandCount)
+	highBand := startBand
+	lowBand := startBand - 1
+	hfrScales := ch.scalefactors[samplesPerSubframe-d.hfrGroupCount:]
+	spectra := &ch.spectra[sf]
+
+	groupLimit := d.hfrGroupCount
+	if d.Version > Version200 {
+		groupLimit >>= 1
+	}
+	for group := 0; group < d.hfrGroupCount; group++ {
+		lowBandSub := 0
+		if group < groupLimit {
+			lowBandSub = 1
+		}
+		for i := 0; i < int(d.BandsPerHfrGroup); i++ {
+			if highBand >= int(d.TotalBandCount) || lowBand < 0 {
+				break
+			}
+			scIndex := int(hfrScales[group]) - int(ch.scalefactors[lowBand]) + 63
+			if scIndex < 0 {
+				scIndex = 0
+			} else if scIndex >= len(scaleConversionTable) {
+				scIndex = len(scaleConversionTable) - 1
+			}
+			spectra[highBand] = scaleConversionTable[scIndex] * spectra[lowBand]
+			highBand++
+			lowBand -= lowBandSub
+		}
+	}
+	spectra[highBand-1] = 0
+}
+
+func (d *Decoder) applyIntensityStereo(i, sf int) {
+	left, right := &d.channels[i], &d.channels[i+1]
+	if left.typ != channelTypeStereoPrimary {
+		return
+	}
+	ratioL := intensityRatioTable[right.intensity[sf]]
+	ratioR := 2 - ratioL
+	for band := int(d.BaseBandCount); band < int(d.TotalBandCount); band++ {
+		right.spectra[sf][band] = left.spectra[sf][band] * ratioR
+		left.spectra[sf][band] = left.spectra[sf][band] * ratioL
+	}
+}
+
+func (d *Decoder) applyMsStereo(i, sf int) {
+	left, right := &d.channels[i], &d.channels[i+1]
+	if d.MsStereo == 0 || left.typ != channelTypeStereoPrimary {
+		return
+	}
+	for band := int(d.BaseBandCount); band < int(d.TotalBandCount); band++ {
+		l := left.spectra[sf][band]
+		r := right.spectra[sf][band]
+		left.spectra[sf][band] = (l + r) * msStereoRatio
+		right.spectra[sf][band] = (l - r) * msStereoRatio
+	}
+}
+
+func (ch *channel) imdctTransform(sf int) {
+	const half = samplesPerSubframe / 2
+	spectra := &ch.spectra[sf]
+	for k := range ch.dct {
+		var sum float32
+		row := &dctTable[k]
+		for n, x := range spectra {
+			sum += x * row[n]
+		}
+		ch.dct[k] = sum
+	}
+
+	wave := &ch.wave[sf]
+	prev := &ch.imdctPrevious
+	for i := 0; i < half; i++ {
+		wave[i] = imdctWindow[i]*ch.dct[i+half] + prev[i]
+		wave[i+half] = imdctWindow[i+half]*ch.dct[samplesPerSubframe-1-i] - prev[i+half]
+	}
+	for i := 0; i < half; i++ {
+		prev[i] = imdctWindow[samplesPerSubframe-1-i] * ch.dct[half-i-1]
+		prev[i+half] = imdctWindow[half-i-1] * ch.dct[i]
+	}
+}
@@ -0,0 +1,320 @@
+// Package hca is CRI HCA audio header parser and decoder
+package hca
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// hca versions
+const (
+	Version101 = 0x0101
+	Version102 = 0x0102
+	Version103 = 0x0103
+	Version200 = 0x0200
+	Version300 = 0x0300
+)
+
+// chunk signatures (high bit of each byte is mask)
+const (
+	chunkMask = 0x7F7F7F7F
+	chunkHca  = 0x48434100 // "HCA\0"
+	chunkFmt  = 0x666D7400 // "fmt\0"
+	chunkComp = 0x636F6D70 // "comp"
+	chunkDec  = 0x64656300 // "dec\0"
+	chunkVbr  = 0x76627200 // "vbr\0"
+	chunkAth  = 0x61746800 // "ath\0"
+	chunkLoop = 0x6C6F6F70 // "loop"
+	chunkCiph = 0x63697068 // "ciph"
+	chunkRva  = 0x72766100 // "rva\0"
+	chunkComm = 0x636F6D6D // "comm"
+)
+
+// ErrNotHca is not hca data error
+var ErrNotHca = errors.New("not hca data")
+
+// ErrInvalidHeader is broken or unsupported hca header error
+var ErrInvalidHeader = errors.New("invalid hca header")
+
+// ErrChecksum is crc16 mismatch error
+var ErrChecksum = errors.New("hca checksum mismatch")
+
+// Header is hca header chunks
+type Header struct {
+	Version    uint16
+	HeaderSize uint16
+
+	// fmt
+	Channels       int
+	SampleRate     int
+	FrameCount     uint32
+	EncoderDelay   uint16
+	EncoderPadding uint16
+
+	// comp or dec
+	FrameSize        uint16
+	MinResolution    byte
+	MaxResolution    byte
+	TrackCount       byte
+	ChannelConfig    byte
+	TotalBandCount   byte
+	BaseBandCount    byte
+	StereoBandCount  byte
+	BandsPerHfrGroup byte
+	MsStereo         byte
+	StereoType       byte
+
+	// vbr
+	VbrMaxFrameSize uint16
+	VbrNoiseLevel   uint16
+
+	// ath
+	AthType uint16
+
+	// loop
+	LoopFlag       bool
+	LoopStartFrame uint32
+	LoopEndFrame   uint32
+	LoopStartDelay uint16
+	LoopEndPadding uint16
+
+	// ciph
+	CiphType   uint16
+	ciphOffset int
+
+	// rva
+	RvaVolume float32
+
+	// comm
+	Comment string
+}
+
+// IsHca reports whether data starts with hca signature
+func IsHca(data []byte) bool {
+	return len(data) >= 8 && binary.BigEndian.Uint32(data)&chunkMask == chunkHca
+}
+
+// HeaderSize returns header size from first 8 bytes of hca data
+func HeaderSize(data []byte) (int, error) {
+	if !IsHca(data) {
+		return 0, ErrNotHca
+	}
+	return int(binary.BigEndian.Uint16(data[6:])), nil
+}
+
+// ParseHeader is parse hca header in data
+func ParseHeader(data []byte) (*Header, error) {
+	size, err := HeaderSize(data)
+	if err != nil {
+		return nil, err
+	}
+	if size > len(data) || size < 8 {
+		return nil, ErrInvalidHeader
+	}
+	if crc16(data[:size]) != 0 {
+		return nil, ErrChecksum
+	}
+
+	h := &Header{}
+	h.Version = binary.BigEndian.Uint16(data[4:])
+	h.HeaderSize = uint16(size)
+	h.RvaVolume = 1
+
+	pos := 8
+	chunk := func(signature uint32, length int) bool {
+		if pos+length > size || binary.BigEndian.Uint32(data[pos:])&chunkMask != signature {
+			return false
+		}
+		pos += 4
+		return true
+	}
+	u16 := func() uint16 {
+		v := binary.BigEndian.Uint16(data[pos:])
+		pos += 2
+		return v
+	}
+	u32 := func() uint32 {
+		v := binary.BigEndian.Uint32(data[pos:])
+		pos += 4
+		return v
+	}
+
+	if !chunk(chunkFmt, 0x10) {
+		return nil, ErrInvalidHeader
+	}
+	h.Channels = int(data[pos])
+	h.SampleRate = int(u32() & 0xFFFFFF)
+	h.FrameCount = u32()
+	h.EncoderDelay = u16()
+	h.EncoderPadding = u16()
+
+	if chunk(chunkComp, 0x10) {
+		h.FrameSize = u16()
+		h.MinResolution = data[pos]
+		h.MaxResolution = data[pos+1]
+		h.TrackCount = data[pos+2]
+		h.ChannelConfig = data[pos+3]
+		h.TotalBandCount = data[pos+4]
+		h.BaseBandCount = data[pos+5]
+		h.StereoBandCount = data[pos+6]
+		h.BandsPerHfrGroup = data[pos+7]
+		h.MsStereo = data[pos+8]
+		pos += 10
+	} else if chunk(chunkDec, 0x0C) {
+		h.FrameSize = u16()
+		h.MinResolution = data[pos]
+		h.MaxResolution = data[pos+1]
+		h.TotalBandCount = data[pos+2] + 1
+		h.BaseBandCount = data[pos+3] + 1
+		h.TrackCount = data[pos+4] >> 4
+		h.ChannelConfig = data[pos+4] & 0x0F
+		h.StereoType = data[pos+5]
+		pos += 6
+		if h.StereoType == 0 {
+			h.BaseBandCount = h.TotalBandCount
+		}
+		h.StereoBandCount = h.TotalBandCount - h.BaseBandCount
+		h.BandsPerHfrGroup = 0
+	} else {
+		return nil, ErrInvalidHeader
+	}
+
+	if chunk(chunkVbr, 0x08) {
+		h.VbrMaxFrameSize = u16()
+		h.VbrNoiseLevel = u16()
+	}
+
+	if chunk(chunkAth, 0x06) {
+		h.AthType = u16()
+	} else if h.Version < Version200 {
+		// v1.x without ath chunk uses ath type 1
+		h.AthType = 1
+	}
+
+	if chunk(chunkLoop, 0x10) {
+		h.LoopFlag = true
+		h.LoopStartFrame = u32()
+		h.LoopEndFrame = u32()
+		h.LoopStartDelay = u16()
+		h.LoopEndPadding = u16()
+	}
+
+	if chunk(chunkCiph, 0x06) {
+		h.ciphOffset = pos
+		h.CiphType = u16()
+	}
+
+	if chunk(chunkRva, 0x08) {
+		h.RvaVolume = math.Float32frombits(u32())
+	}
+
+	if chunk(chunkComm, 0x05) {
+		length := int(data[pos])
+		pos++
+		if pos+length > size {
+			return nil, ErrInvalidHeader
+		}
+		comment := data[pos : pos+length]
+		for i, c := range comment {
+			if c == 0 {
+				comment = comment[:i]
+				break
+			}
+		}
+		h.Comment = string(comment)
+		pos += length
+	}
+
+	err = h.validate()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Header) validate() error {
+	if h.Channels < 1 || h.Channels > maxChannels || h.SampleRate < 1 || h.FrameCount == 0 {
+		return ErrInvalidHeader
+	}
+	if h.FrameSize < 8 && h.VbrMaxFrameSize == 0 {
+		return ErrInvalidHeader
+	}
+	if h.MinResolution > h.MaxResolution || h.MaxResolution > 15 {
+		return ErrInvalidHeader
+	}
+	if h.LoopFlag && (h.LoopStartFrame > h.LoopEndFrame || h.LoopEndFrame >= h.FrameCount) {
+		return ErrInvalidHeader
+	}
+	if h.TrackCount == 0 {
+		h.TrackCount = 1
+	}
+	if int(h.TrackCount) > h.Channels {
+		return ErrInvalidHeader
+	}
+	if int(h.BaseBandCount)+int(h.StereoBandCount) > samplesPerSubframe ||
+		h.TotalBandCount > samplesPerSubframe || h.BandsPerHfrGroup > samplesPerSubframe {
+		return ErrInvalidHeader
+	}
+	return nil
+}
+
+// NumSamples returns playable sample count per channel
+func (h *Header) NumSamples() int {
+	return int(h.FrameCount)*samplesPerFrame - int(h.EncoderDelay) - int(h.EncoderPadding)
+}
+
+// LoopStartSample returns loop start position in samples
+func (h *Header) LoopStartSample() int {
+	return int(h.LoopStartFrame)*samplesPerFrame + int(h.LoopStartDelay) - int(h.EncoderDelay)
+}
+
+// LoopEndSample returns loop end position (exclusive) in samples
+func (h *Header) LoopEndSample() int {
+	return int(h.LoopEndFrame+1)*samplesPerFrame - int(h.LoopEndPadding) - int(h.EncoderDelay)
+}
+
+func (h *Header) hfrGroupCount() int {
+	count := int(h.TotalBandCount) - int(h.BaseBandCount) - int(h.StereoBandCount)
+	if h.BandsPerHfrGroup == 0 || count <= 0 {
+		return 0
+	}
+	return (count + int(h.BandsPerHfrGroup) - 1) / int(h.BandsPerHfrGroup)
+}
+
+// channelTypes returns stereo role of each channel
+func (h *Header) channelTypes() []int {
+	types := make([]int, h.Channels)
+	channelsPerTrack := h.Channels / int(h.TrackCount)
+	if h.StereoBandCount == 0 || channelsPerTrack <= 1 {
+		return types
+	}
+	p, s, d := channelTypeStereoPrimary, channelTypeStereoSecondary, channelTypeDiscrete
+	var layout []int
+	switch channelsPerTrack {
+	case 2:
+		layout = []int{p, s}
+	case 3:
+		layout = []int{p, s, d}
+	case 4:
+		layout = []int{p, s, d, d}
+		if h.ChannelConfig == 0 {
+			layout = []int{p, s, p, s}
+		}
+	case 5:
+		layout = []int{p, s, d, d, d}
+		if h.ChannelConfig <= 2 {
+			layout = []int{p, s, d, p, s}
+		}
+	case 6:
+		layout = []int{p, s, d, d, p, s}
+	case 7:
+		layout = []int{p, s, d, d, p, s, d}
+	case 8:
+		layout = []int{p, s, d, d, p, s, p, s}
+	}
+	for i := 0; i+len(layout) <= len(types) && layout != nil; i += channelsPerTrack {
+		copy(types[i:], layout)
+	}
+	return types
+}
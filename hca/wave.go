@@ -0,0 +1,34 @@
+package hca
+
+import (
+	"io"
+
+	"github.com/vazrupe/go-acb/wav"
+)
+
+// DecodeWave decodes whole hca stream in r to *wav.Wave
+func DecodeWave(r io.Reader, format wav.SampleFormat) (*wav.Wave, error) {
+	return DecodeWaveWithKey(r, 0, format)
+}
+
+// DecodeWaveWithKey decodes whole encrypted hca stream in r to *wav.Wave
+func DecodeWaveWithKey(r io.Reader, keycode uint64, format wav.SampleFormat) (*wav.Wave, error) {
+	d, err := NewDecoderWithKey(r, keycode)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := d.DecodeAll()
+	if err != nil {
+		return nil, err
+	}
+	wave := &wav.Wave{
+		Channels:   d.Channels,
+		SampleRate: d.SampleRate,
+		Format:     format,
+		Samples:    samples,
+	}
+	if d.LoopFlag {
+		wave.Loop = &wav.Loop{Start: d.LoopStartSample(), End: d.LoopEndSample()}
+	}
+	return wave, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vazrupe/go-acb/acb"
+)
+
+func runList(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.Usage = usage(flags, "list [-waveforms] ACB_FILEs...")
+	waveforms := flags.Bool("waveforms", false, "show every waveform of cue")
+	flags.Parse(args)
+
+	for _, filename := range flags.Args() {
+		f, err := acb.LoadCriAcbFile(filename)
+		if err != nil {
+			fmt.Printf("Error: %s Open Failed (%s)\n", filename, err)
+			continue
+		}
+		fmt.Printf("%s (version %s, %d cues)\n", filename, acb.AcbVersionString(f.Version()), len(f.Cue))
+		listCues(f, *waveforms)
+		f.Close()
+	}
+}
+
+// listCues prints length and format of cues, format of first waveform is shown for cue
+func listCues(f *acb.CriAcbFile, waveforms bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  ID\tNAME\tLENGTH\tCH\tRATE\tFORMAT\tWAVEFORMS")
+	for _, cue := range f.Cue {
+		var channels, rate, format string
+		if len(cue.Waveforms) > 0 {
+			first := cue.Waveforms[0]
+			channels, rate, format = waveformFormat(first)
+		}
+		fmt.Fprintf(w, "  %d\t%s\t%s\t%s\t%s\t%s\t%d\n", cue.CueID, cue.CueName, formatDuration(cue.Duration()), channels, rate, format, len(cue.Waveforms))
+		if !waveforms || len(cue.Waveforms) < 2 {
+			continue
+		}
+		for _, waveform := range cue.Waveforms {
+			channels, rate, format := waveformFormat(waveform)
+			fmt.Fprintf(w, "    %d\t%s\t%s\t%s\t%s\t%s\t\n", waveform.ID, waveform.Role, formatDuration(waveform.Duration()), channels, rate, format)
+		}
+	}
+	w.Flush()
+}
+
+// waveformFormat returns channel count, sampling rate and format columns
+func waveformFormat(waveform acb.CriAcbCueWaveform) (channels, rate, format string) {
+	format = strings.TrimPrefix(waveform.GetFileExtension(), ".")
+	if waveform.IsStreaming {
+		format += " (stream)"
+	}
+	if waveform.NumChannels == 0 || waveform.SamplingRate == 0 {
+		return "-", "-", format
+	}
+	return fmt.Sprint(waveform.NumChannels), fmt.Sprint(waveform.SamplingRate), format
+}
+
+// formatDuration returns duration as m:ss.mmm, "-" when it is unknown
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%d:%02d.%03d", ms/60000, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/vazrupe/go-acb/usm"
+)
+
+// streamKinds are output name of stream signatures
+var streamKinds = map[string]string{
+	usm.SignatureVideo:    "video",
+	usm.SignatureAudio:    "audio",
+	usm.SignatureAlpha:    "alpha",
+	usm.SignatureSubtitle: "subtitle",
+}
+
+func runUsm(args []string) {
+	flags := flag.NewFlagSet("usm", flag.ExitOnError)
+	flags.Usage = usage(flags, "usm [-key=KEY] [-save=YOUR_SAVE_DIR] [-f] USM_FILEs...")
+	saveDir := flags.String("save", "", "output dir (default: next to usm file)")
+	force := flags.Bool("f", false, "overwrite existing output files")
+	keyString := flags.String("key", "", "usm 64bit key (decimal or 0x hex)")
+	flags.Parse(args)
+
+	var key uint64
+	if *keyString != "" {
+		var err error
+		key, err = strconv.ParseUint(*keyString, 0, 64)
+		if err != nil {
+			fmt.Printf("Error: invalid usm key `%s`\n", *keyString)
+			os.Exit(2)
+		}
+	}
+
+	for _, filename := range flags.Args() {
+		dir := filepath.Dir(filename)
+		if *saveDir != "" {
+			dir = *saveDir
+		}
+		base := filepath.Base(filename)
+		base = base[:len(base)-len(filepath.Ext(base))]
+
+		streams, err := demuxUsm(filename, key, func(s *usm.Stream) string {
+			kind, ok := streamKinds[s.Signature]
+			if !ok {
+				kind = "stream"
+			}
+			return filepath.Join(dir, fmt.Sprintf("%s_%s%d%s", base, kind, s.Channel, s.Ext))
+		}, *force)
+		if err != nil {
+			fmt.Printf("Error: %s Demux Failed (%s)\n", filename, err)
+			continue
+		}
+		for _, s := range streams {
+			if s.Size > 0 {
+				fmt.Printf("Demux: %s %s%d -> %s (%d bytes)\n", filepath.Base(filename), streamKinds[s.Signature], s.Channel, s.Ext, s.Size)
+			}
+		}
+	}
+}
+
+// demuxUsm writes streams of usm file to files named by outputName
+func demuxUsm(filename string, key uint64, outputName func(*usm.Stream) string, force bool) ([]*usm.Stream, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []*os.File
+	defer func() {
+		for _, out := range files {
+			out.Close()
+		}
+	}()
+	return usm.Demux(f, key, func(s *usm.Stream) (io.Writer, error) {
+		name := outputName(s)
+		if _, err := os.Stat(name); err == nil && !force {
+			fmt.Printf("Exists: `%s`. skip\n", name)
+			return nil, nil
+		}
+		err := os.MkdirAll(filepath.Dir(name), 0755)
+		if err != nil {
+			return nil, err
+		}
+		out, err := os.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, out)
+		return out, nil
+	})
+}
@@ -0,0 +1,86 @@
+package usm
+
+// masks are xor tables generated from 64bit key
+type masks struct {
+	video1 [0x20]byte
+	video2 [0x20]byte
+	audio  [0x20]byte
+}
+
+// newMasks returns video and audio masks of key
+func newMasks(key uint64) *masks {
+	key1 := uint32(key)
+	key2 := uint32(key >> 32)
+	var t [0x20]byte
+	t[0x00] = byte(key1)
+	t[0x01] = byte(key1 >> 8)
+	t[0x02] = byte(key1 >> 16)
+	t[0x03] = byte(key1>>24) - 0x34
+	t[0x04] = byte(key2) + 0xF9
+	t[0x05] = byte(key2>>8) ^ 0x13
+	t[0x06] = byte(key2>>16) + 0x61
+	t[0x07] = t[0x00] ^ 0xFF
+	t[0x08] = t[0x01] + t[0x02]
+	t[0x09] = t[0x01] - t[0x07]
+	t[0x0A] = t[0x02] ^ 0xFF
+	t[0x0B] = t[0x01] ^ 0xFF
+	t[0x0C] = t[0x0B] + t[0x09]
+	t[0x0D] = t[0x08] - t[0x03]
+	t[0x0E] = t[0x0D] ^ 0xFF
+	t[0x0F] = t[0x0A] - t[0x0B]
+	t[0x10] = t[0x08] - t[0x0F]
+	t[0x11] = t[0x10] ^ t[0x07]
+	t[0x12] = t[0x0F] ^ 0xFF
+	t[0x13] = t[0x03] ^ 0x10
+	t[0x14] = t[0x04] - 0x32
+	t[0x15] = t[0x05] + 0xED
+	t[0x16] = t[0x06] ^ 0xF3
+	t[0x17] = t[0x13] - t[0x0F]
+	t[0x18] = t[0x15] + t[0x07]
+	t[0x19] = 0x21 - t[0x13]
+	t[0x1A] = t[0x14] ^ t[0x17]
+	t[0x1B] = t[0x16] + t[0x16]
+	t[0x1C] = t[0x17] + 0x44
+	t[0x1D] = t[0x03] + t[0x04]
+	t[0x1E] = t[0x05] - t[0x16]
+	t[0x1F] = t[0x1D] ^ t[0x13]
+
+	urcu := []byte("URUC")
+	m := &masks{}
+	for i := range t {
+		m.video1[i] = t[i]
+		m.video2[i] = t[i] ^ 0xFF
+		if i&1 == 1 {
+			m.audio[i] = urcu[(i>>1)&3]
+		} else {
+			m.audio[i] = t[i] ^ 0xFF
+		}
+	}
+	return m
+}
+
+// unmaskVideo decrypts video payload, the first 0x40 bytes are not masked
+// bytes from 0x140 are chained by the previous plain byte, then bytes 0x40-0x13F are masked by them
+func (m *masks) unmaskVideo(data []byte) {
+	if len(data) < 0x240 {
+		return
+	}
+	data = data[0x40:]
+	mask := m.video2
+	for i := 0x100; i < len(data); i++ {
+		data[i] ^= mask[i&0x1F]
+		mask[i&0x1F] = data[i] ^ m.video2[i&0x1F]
+	}
+	mask = m.video1
+	for i := 0; i < 0x100; i++ {
+		mask[i&0x1F] ^= data[0x100+i]
+		data[i] ^= mask[i&0x1F]
+	}
+}
+
+// unmaskAudio decrypts audio payload, the first 0x140 bytes are not masked
+func (m *masks) unmaskAudio(data []byte) {
+	for i := 0x140; i < len(data); i++ {
+		data[i] ^= m.audio[(i-0x140)&0x1F]
+	}
+}
@@ -0,0 +1,75 @@
+package usm
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+const testKey = 0x0123456789ABCDEF
+
+// testData returns n bytes of lcg, period is longer than video mask chain
+func testData(n int) []byte {
+	data := make([]byte, n)
+	x := uint32(1)
+	for i := range data {
+		x = x*1103515245 + 12345
+		data[i] = byte(x >> 16)
+	}
+	return data
+}
+
+func TestNewMasks(t *testing.T) {
+	m := newMasks(testKey)
+	for _, c := range []struct {
+		name string
+		mask [0x20]byte
+		want string
+	}{
+		{"video1", m.video1, "efcdab556056841078bd5432ef23dc225646dd452e43772353dc0dee67b5dff0"},
+		{"video2", m.video2, "103254aa9fa97bef8742abcd10dc23dda9b922bad1bc88dcac23f211984a200f"},
+		{"audio", m.audio, "105554529f557b438755ab5210552343a9552252d1558843ac55f25298552043"},
+	} {
+		if got := hex.EncodeToString(c.mask[:]); got != c.want {
+			t.Errorf("%s = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestUnmaskVideo(t *testing.T) {
+	data := testData(0x260)
+	plain := append([]byte{}, data[:0x40]...)
+	newMasks(testKey).unmaskVideo(data)
+	if hex.EncodeToString(data[:0x40]) != hex.EncodeToString(plain) {
+		t.Errorf("first 0x40 bytes are changed")
+	}
+	for _, c := range []struct {
+		offset int
+		want   string
+	}{
+		{0x40, "c57a22d3a304796182a488752ec309311f2acb2bb68c0cd111fbb5a9e1662720"},
+		{0x140, "c4f4f1cbcea843d720fd5ac91dc9b85db63af71eb834f4431a2228828f0fab1d"},
+		{0x240, "c8531069e8a9b975b83c3f90456a1f1f47cad5befb7ff386ea723180bb2d7347"},
+	} {
+		if got := hex.EncodeToString(data[c.offset : c.offset+0x20]); got != c.want {
+			t.Errorf("bytes at %x = %s, want %s", c.offset, got, c.want)
+		}
+	}
+
+	short := testData(0x23F)
+	newMasks(testKey).unmaskVideo(short)
+	if hex.EncodeToString(short) != hex.EncodeToString(testData(0x23F)) {
+		t.Errorf("payload shorter than 0x240 is changed")
+	}
+}
+
+func TestUnmaskAudio(t *testing.T) {
+	data := testData(0x160)
+	newMasks(testKey).unmaskAudio(data)
+	if hex.EncodeToString(data[:0x140]) != hex.EncodeToString(testData(0x140)) {
+		t.Errorf("first 0x140 bytes are changed")
+	}
+	want := "c493f133ce54437b20ea5a561d40b8c3b6d6f7f6b8ddf4dc1a5428c18f10ab51"
+	if got := hex.EncodeToString(data[0x140:]); got != want {
+		t.Errorf("bytes at 140 = %s, want %s", got, want)
+	}
+}
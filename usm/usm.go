@@ -0,0 +1,238 @@
+// Package usm is CRI USM movie demuxer
+package usm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/vazrupe/go-acb/acb"
+	"github.com/vazrupe/go-acb/adx"
+	"github.com/vazrupe/go-acb/hca"
+)
+
+// chunk signatures
+const (
+	SignatureCrid     = "CRID"
+	SignatureVideo    = "@SFV"
+	SignatureAudio    = "@SFA"
+	SignatureAlpha    = "@ALP"
+	SignatureSubtitle = "@SBT"
+	SignatureCue      = "@CUE"
+)
+
+// chunk payload types
+const (
+	ChunkTypeStream     = 0
+	ChunkTypeHeader     = 1
+	ChunkTypeSectionEnd = 2
+	ChunkTypeMetadata   = 3
+)
+
+// chunkHeaderSize is signature, chunk size and header fields before payload
+const chunkHeaderSize = 0x20
+
+// ErrNotUsm is not usm data error
+var ErrNotUsm = errors.New("not usm data")
+
+// ErrBrokenChunk is broken chunk header error
+var ErrBrokenChunk = errors.New("broken usm chunk")
+
+// Chunk is usm chunk, stream data is decrypted
+type Chunk struct {
+	Signature string
+	Channel   byte
+	Type      byte
+	FrameTime uint32
+	FrameRate uint32
+	Data      []byte
+}
+
+// Table returns @UTF table of header or metadata chunk
+func (c *Chunk) Table() (*acb.CriUtfTable, error) {
+	return acb.NewCriUtfTable(bytes.NewReader(c.Data), 0)
+}
+
+// Demuxer reads usm chunks
+type Demuxer struct {
+	r      io.Reader
+	masks  *masks
+	first  bool
+	noMask map[streamKey]bool
+}
+
+// streamKey is stream signature and channel
+type streamKey struct {
+	signature string
+	channel   byte
+}
+
+// NewDemuxer returns demuxer of usm without encryption
+func NewDemuxer(r io.Reader) *Demuxer {
+	return &Demuxer{r: r, first: true, noMask: make(map[streamKey]bool)}
+}
+
+// NewDemuxerWithKey returns demuxer of usm encrypted by 64bit key
+func NewDemuxerWithKey(r io.Reader, key uint64) *Demuxer {
+	d := NewDemuxer(r)
+	d.masks = newMasks(key)
+	return d
+}
+
+// Next returns next chunk, io.EOF at the end of usm
+func (d *Demuxer) Next() (*Chunk, error) {
+	head := make([]byte, chunkHeaderSize)
+	_, err := io.ReadFull(d.r, head)
+	if err != nil {
+		if d.first {
+			return nil, ErrNotUsm
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrBrokenChunk
+		}
+		return nil, err
+	}
+	if d.first && string(head[:4]) != SignatureCrid {
+		return nil, ErrNotUsm
+	}
+	d.first = false
+
+	size := int64(binary.BigEndian.Uint32(head[4:]))
+	dataOffset := int64(head[9])
+	padding := int64(binary.BigEndian.Uint16(head[0x0A:]))
+	if dataOffset < chunkHeaderSize-8 || dataOffset+padding > size {
+		return nil, ErrBrokenChunk
+	}
+	body := make([]byte, size+8-chunkHeaderSize)
+	_, err = io.ReadFull(d.r, body)
+	if err != nil {
+		return nil, ErrBrokenChunk
+	}
+
+	c := &Chunk{
+		Signature: string(head[:4]),
+		Channel:   head[0x0C],
+		Type:      head[0x0F] & 3,
+		FrameTime: binary.BigEndian.Uint32(head[0x10:]),
+		FrameRate: binary.BigEndian.Uint32(head[0x14:]),
+		Data:      body[dataOffset+8-chunkHeaderSize : size-padding+8-chunkHeaderSize],
+	}
+	if c.Type == ChunkTypeStream {
+		d.unmask(c)
+	}
+	return c, nil
+}
+
+// unmask decrypts stream chunk, hca audio is encrypted by hca cipher and not masked
+func (d *Demuxer) unmask(c *Chunk) {
+	if d.masks == nil {
+		return
+	}
+	switch c.Signature {
+	case SignatureVideo, SignatureAlpha:
+		d.masks.unmaskVideo(c.Data)
+	case SignatureAudio:
+		key := streamKey{c.Signature, c.Channel}
+		noMask, ok := d.noMask[key]
+		if !ok {
+			noMask = hca.IsHca(c.Data)
+			d.noMask[key] = noMask
+		}
+		if !noMask {
+			d.masks.unmaskAudio(c.Data)
+		}
+	}
+}
+
+// Stream is elementary stream in usm
+type Stream struct {
+	Signature string
+	Channel   byte
+	// Header is VIDEO_HDRINFO or AUDIO_HDRINFO table, nil when usm has no header
+	Header *acb.CriUtfTable
+	// Ext is file extension of stream data (.m2v, .ivf, .h264, .adx, .hca or .bin)
+	Ext  string
+	Size int64
+}
+
+// streamExt returns file extension of first stream data
+func streamExt(signature string, data []byte) string {
+	switch {
+	case signature == SignatureAudio && hca.IsHca(data):
+		return ".hca"
+	case signature == SignatureAudio && adx.IsAdx(data):
+		return ".adx"
+	case signature == SignatureVideo || signature == SignatureAlpha:
+		switch {
+		case bytes.HasPrefix(data, []byte("DKIF")):
+			return ".ivf"
+		case bytes.HasPrefix(data, []byte{0, 0, 1, 0xB3}):
+			return ".m2v"
+		case bytes.HasPrefix(data, []byte{0, 0, 0, 1}), bytes.HasPrefix(data, []byte{0, 0, 1}):
+			return ".h264"
+		}
+	case signature == SignatureSubtitle:
+		return ".sbt"
+	}
+	return ".bin"
+}
+
+// Demux writes each stream data to writer returned by create, create is called on first data of stream
+// and nil writer skips the stream. key 0 is unencrypted usm
+func Demux(r io.Reader, key uint64, create func(s *Stream) (io.Writer, error)) ([]*Stream, error) {
+	d := NewDemuxer(r)
+	if key != 0 {
+		d = NewDemuxerWithKey(r, key)
+	}
+	var streams []*Stream
+	found := make(map[streamKey]*Stream)
+	writers := make(map[streamKey]io.Writer)
+	for {
+		c, err := d.Next()
+		if err == io.EOF {
+			return streams, nil
+		}
+		if err != nil {
+			return streams, err
+		}
+		if c.Signature == SignatureCrid || c.Signature == SignatureCue {
+			continue
+		}
+
+		k := streamKey{c.Signature, c.Channel}
+		s, ok := found[k]
+		if !ok {
+			s = &Stream{Signature: c.Signature, Channel: c.Channel}
+			found[k] = s
+			streams = append(streams, s)
+		}
+		switch c.Type {
+		case ChunkTypeHeader:
+			if s.Header == nil {
+				s.Header, err = c.Table()
+				if err != nil {
+					return streams, err
+				}
+			}
+		case ChunkTypeStream:
+			w, ok := writers[k]
+			if !ok {
+				s.Ext = streamExt(c.Signature, c.Data)
+				w, err = create(s)
+				if err != nil {
+					return streams, err
+				}
+				writers[k] = w
+			}
+			if w == nil {
+				continue
+			}
+			n, err := w.Write(c.Data)
+			s.Size += int64(n)
+			if err != nil {
+				return streams, err
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package usm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// chunkBytes returns chunk of payload with data offset and padding after payload
+func chunkBytes(signature string, channel, chunkType byte, dataOffset int, payload []byte, padding int) []byte {
+	chunk := make([]byte, 8+dataOffset+len(payload)+padding)
+	copy(chunk, signature)
+	binary.BigEndian.PutUint32(chunk[4:], uint32(len(chunk)-8))
+	chunk[9] = byte(dataOffset)
+	binary.BigEndian.PutUint16(chunk[0x0A:], uint16(padding))
+	chunk[0x0C] = channel
+	chunk[0x0F] = chunkType
+	binary.BigEndian.PutUint32(chunk[0x10:], 100)
+	binary.BigEndian.PutUint32(chunk[0x14:], 2997)
+	copy(chunk[8+dataOffset:], payload)
+	return chunk
+}
+
+func TestDemuxerNext(t *testing.T) {
+	video := testData(0x260)
+	audio := testData(0x160)
+	var usm bytes.Buffer
+	usm.Write(chunkBytes(SignatureCrid, 0, ChunkTypeHeader, 0x18, []byte("crid"), 0))
+	usm.Write(chunkBytes(SignatureVideo, 0, ChunkTypeStream, 0x20, video, 0x10))
+	usm.Write(chunkBytes(SignatureAudio, 1, ChunkTypeStream, 0x18, audio, 3))
+	usm.Write(chunkBytes(SignatureAudio, 1, ChunkTypeSectionEnd, 0x18, []byte("#CONTENTS END"), 0))
+
+	wantVideo := append([]byte{}, video...)
+	newMasks(testKey).unmaskVideo(wantVideo)
+	wantAudio := append([]byte{}, audio...)
+	newMasks(testKey).unmaskAudio(wantAudio)
+	want := []Chunk{
+		{Signature: SignatureCrid, Type: ChunkTypeHeader, Data: []byte("crid")},
+		{Signature: SignatureVideo, Type: ChunkTypeStream, Data: wantVideo},
+		{Signature: SignatureAudio, Channel: 1, Type: ChunkTypeStream, Data: wantAudio},
+		{Signature: SignatureAudio, Channel: 1, Type: ChunkTypeSectionEnd, Data: []byte("#CONTENTS END")},
+	}
+
+	d := NewDemuxerWithKey(&usm, testKey)
+	for i, w := range want {
+		c, err := d.Next()
+		if err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+		if c.Signature != w.Signature || c.Channel != w.Channel || c.Type != w.Type || c.FrameTime != 100 || c.FrameRate != 2997 {
+			t.Errorf("chunk %d = %s channel %d type %d time %d rate %d", i, c.Signature, c.Channel, c.Type, c.FrameTime, c.FrameRate)
+		}
+		if !bytes.Equal(c.Data, w.Data) {
+			t.Errorf("chunk %d data = %x, want %x", i, c.Data, w.Data)
+		}
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Errorf("err after last chunk = %v, want io.EOF", err)
+	}
+}
+
+func TestDemuxerBrokenChunk(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"not usm", chunkBytes(SignatureVideo, 0, ChunkTypeStream, 0x18, []byte("data"), 0), ErrNotUsm},
+		{"data offset in header", chunkBytes(SignatureCrid, 0, ChunkTypeHeader, 0x10, make([]byte, 0x20), 0), ErrBrokenChunk},
+		{"padding after chunk", func() []byte {
+			chunk := chunkBytes(SignatureCrid, 0, ChunkTypeHeader, 0x18, []byte("data"), 0)
+			binary.BigEndian.PutUint16(chunk[0x0A:], 8)
+			return chunk
+		}(), ErrBrokenChunk},
+		{"truncated", chunkBytes(SignatureCrid, 0, ChunkTypeHeader, 0x18, []byte("data"), 0)[:0x22], ErrBrokenChunk},
+	} {
+		_, err := NewDemuxer(bytes.NewReader(c.data)).Next()
+		if err != c.err {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vazrupe/go-acb/acb"
+)
+
+func runVerify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = usage(flags, "verify [-hash=false] DIRs_OR_ACB_FILEs...")
+	hash := flags.Bool("hash", true, "compare StreamAwbHash, the whole awb is read")
+	flags.Parse(args)
+
+	failed := 0
+	for _, root := range flags.Args() {
+		err := filepath.WalkDir(root, func(filename string, d fs.DirEntry, err error) error {
+			if err != nil {
+				fmt.Printf("Error: %s (%s)\n", filename, err)
+				failed++
+				return nil
+			}
+			if d.IsDir() || !strings.EqualFold(filepath.Ext(filename), ".acb") {
+				return nil
+			}
+			if !verifyAcb(filename, *hash) {
+				failed++
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error: %s (%s)\n", root, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// verifyAcb checks streaming awbs of acb, false when awb is missing or does not match
+func verifyAcb(filename string, hash bool) bool {
+	f, err := acb.LoadCriAcbFile(filename)
+	switch {
+	case errors.Is(err, acb.ErrAwbMismatch):
+		fmt.Printf("Mismatch: %s (%s)\n", filename, err)
+		return false
+	case errors.Is(err, acb.ErrAwbFileNotFound):
+		fmt.Printf("Missing: %s (%s)\n", filename, err)
+		return false
+	case err != nil:
+		fmt.Printf("Error: %s Open Failed (%s)\n", filename, err)
+		return false
+	}
+	defer f.Close()
+
+	if len(f.StreamAwbs) == 0 {
+		fmt.Printf("OK: %s (no streaming awb)\n", filename)
+		return true
+	}
+	if hash {
+		err = f.VerifyStreamAwbs()
+		if err != nil {
+			fmt.Printf("Mismatch: %s (%s)\n", filename, err)
+			return false
+		}
+	}
+	fmt.Printf("OK: %s (%d streaming awb)\n", filename, len(f.StreamAwbs))
+	return true
+}
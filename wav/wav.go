@@ -0,0 +1,128 @@
+// Package wav is RIFF WAVE writer for decoded audio
+package wav
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// SampleFormat is wav sample encoding
+type SampleFormat int
+
+// sample formats
+const (
+	PCM16 SampleFormat = iota
+	Float32
+)
+
+const (
+	formatTagPCM   = 0x0001
+	formatTagFloat = 0x0003
+)
+
+// Loop is loop region in samples per channel. End is exclusive
+type Loop struct {
+	Start int
+	End   int
+}
+
+// Wave is interleaved pcm audio
+type Wave struct {
+	Channels   int
+	SampleRate int
+	Format     SampleFormat
+	Samples    []float32
+
+	// Loop is written as smpl chunk when not nil
+	Loop *Loop
+}
+
+func (w *Wave) bytesPerSample() int {
+	if w.Format == Float32 {
+		return 4
+	}
+	return 2
+}
+
+// WriteTo writes wave as RIFF WAVE file
+func (w *Wave) WriteTo(out io.Writer) (n int64, err error) {
+	bytesPerSample := w.bytesPerSample()
+	formatTag := uint16(formatTagPCM)
+	if w.Format == Float32 {
+		formatTag = formatTagFloat
+	}
+	dataSize := len(w.Samples) * bytesPerSample
+	blockAlign := w.Channels * bytesPerSample
+
+	smpl := w.smplChunk()
+
+	header := make([]byte, 36)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(header)-8+len(smpl)+8+dataSize))
+	copy(header[8:], "WAVE")
+
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], formatTag)
+	binary.LittleEndian.PutUint16(header[22:], uint16(w.Channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(w.SampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:], uint16(bytesPerSample*8))
+
+	header = append(header, smpl...)
+	dataHeader := make([]byte, 8)
+	copy(dataHeader, "data")
+	binary.LittleEndian.PutUint32(dataHeader[4:], uint32(dataSize))
+	header = append(header, dataHeader...)
+
+	written, err := out.Write(header)
+	n += int64(written)
+	if err != nil {
+		return
+	}
+
+	data := make([]byte, dataSize)
+	for i, s := range w.Samples {
+		if w.Format == Float32 {
+			binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(s))
+		} else {
+			binary.LittleEndian.PutUint16(data[i*2:], uint16(ToInt16(s)))
+		}
+	}
+	written, err = out.Write(data)
+	n += int64(written)
+	return
+}
+
+// smplChunk returns sampler chunk with one forward loop
+func (w *Wave) smplChunk() []byte {
+	if w.Loop == nil || w.Loop.End <= w.Loop.Start {
+		return nil
+	}
+	chunk := make([]byte, 8+36+24)
+	copy(chunk, "smpl")
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(chunk)-8))
+	if w.SampleRate > 0 {
+		binary.LittleEndian.PutUint32(chunk[16:], uint32(1000000000/w.SampleRate))
+	}
+	binary.LittleEndian.PutUint32(chunk[20:], 60) // midi unity note
+	binary.LittleEndian.PutUint32(chunk[36:], 1)  // loop count
+
+	loop := chunk[44:]
+	binary.LittleEndian.PutUint32(loop[8:], uint32(w.Loop.Start))
+	binary.LittleEndian.PutUint32(loop[12:], uint32(w.Loop.End-1))
+	return chunk
+}
+
+// ToInt16 converts [-1, 1) float sample to clipped 16bit sample
+func ToInt16(s float32) int16 {
+	v := int32(s * 32768)
+	if v > math.MaxInt16 {
+		v = math.MaxInt16
+	} else if v < math.MinInt16 {
+		v = math.MinInt16
+	}
+	return int16(v)
+}